@@ -0,0 +1,454 @@
+package bluesky
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EmbedCard  = "card"
+	EmbedImage = "image"
+
+	DefaultServer = "https://bsky.social"
+
+	createSessionPath = "/xrpc/com.atproto.server.createSession"
+	uploadBlobPath    = "/xrpc/com.atproto.repo.uploadBlob"
+	createRecordPath  = "/xrpc/com.atproto.repo.createRecord"
+	deleteRecordPath  = "/xrpc/com.atproto.repo.deleteRecord"
+
+	postCollection = "app.bsky.feed.post"
+	linkFacet      = "app.bsky.richtext.facet#link"
+	externalEmbed  = "app.bsky.embed.external"
+	imagesEmbed    = "app.bsky.embed.images"
+	expiredToken   = "ExpiredToken"
+	mimeType       = "application/json"
+	handleSep      = "|"
+
+	maxPostLength = 300
+	maxImageSize  = 1 << 20
+)
+
+// Account holds the settings of a Bluesky account, addressed by name as the notification target.
+type Account struct {
+	// Server is the base URL of the PDS hosting the account.
+	Server string
+	// Identifier is the handle or DID of the account.
+	Identifier string
+	// Password should be an app password.
+	Password string
+	// Language is the BCP 47 code of the posts.
+	Language string
+	// Embed is either card (link card with the thumbnail) or image (attached thumbnail).
+	Embed string
+}
+
+type Sender struct {
+	accounts map[string]*account
+	client   *http.Client
+}
+
+var _ port.Notifier = (*Sender)(nil)
+var _ port.MessageDeleter = (*Sender)(nil)
+var _ port.MessageReplier = (*Sender)(nil)
+
+type account struct {
+	Account
+
+	mu      sync.Mutex
+	session session
+}
+
+type session struct {
+	AccessJwt string `json:"accessJwt"`
+	DID       string `json:"did"`
+}
+
+// strongRef references a record, the message handle of a post is its URI and CID joined by handleSep.
+type strongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+type errorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func NewBlueskySender(accounts map[string]Account) (*Sender, error) {
+	s := &Sender{
+		accounts: make(map[string]*account),
+		client:   &http.Client{},
+	}
+
+	for name, a := range accounts {
+		if a.Identifier == "" || a.Password == "" {
+			return nil, fmt.Errorf("identifier and password must be set for bluesky account %s", name)
+		}
+		if a.Server == "" {
+			a.Server = DefaultServer
+		}
+
+		switch a.Embed {
+		case "":
+			a.Embed = EmbedCard
+		case EmbedCard, EmbedImage:
+		default:
+			return nil, fmt.Errorf("invalid embed %q for bluesky account %s", a.Embed, name)
+		}
+
+		a.Server = strings.TrimSuffix(a.Server, "/")
+		s.accounts[strings.ToLower(name)] = &account{Account: a}
+	}
+
+	return s, nil
+}
+
+// SendStreamInfo creates a go-live post with a link facet and an embedded thumbnail for a domain.StreamInfo.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	a, err := s.account(target)
+	if err != nil {
+		return "", err
+	}
+
+	did, err := s.did(ctx, a)
+	if err != nil {
+		return "", err
+	}
+
+	var viewerInfo string
+	if stream.ViewerCount > -1 {
+		viewerInfo = fmt.Sprintf(" for %d viewers", stream.ViewerCount)
+	}
+
+	prefix := "🔴 " + stream.Username + " is streaming "
+	suffix := viewerInfo + "\n\n" + stream.URL
+	title := truncate(stream.Title, maxPostLength-utf8.RuneCountInString(prefix+suffix))
+	record := a.newPost(prefix+title+suffix, stream.URL)
+
+	var thumb json.RawMessage
+	if stream.ThumbnailURL != "" {
+		thumb, err = s.uploadThumbnail(ctx, a, stream.ThumbnailURL)
+		if err != nil {
+			log.Warn().Err(err).Str("stream", stream.Username).Msg("failed to upload thumbnail, posting without")
+		}
+	}
+
+	switch {
+	case a.Embed == EmbedImage && thumb != nil:
+		record["embed"] = map[string]any{
+			"$type":  imagesEmbed,
+			"images": []map[string]any{{"alt": stream.Username + " stream thumbnail", "image": thumb}},
+		}
+	case a.Embed == EmbedCard && stream.URL != "":
+		external := map[string]any{
+			"uri":         stream.URL,
+			"title":       stream.Username,
+			"description": stream.Title,
+		}
+		if thumb != nil {
+			external["thumb"] = thumb
+		}
+		record["embed"] = map[string]any{"$type": externalEmbed, "external": external}
+	}
+
+	var ref strongRef
+	err = s.call(ctx, a, createRecordPath, map[string]any{
+		"repo":       did,
+		"collection": postCollection,
+		"record":     record,
+	}, &ref)
+	if err != nil {
+		return "", fmt.Errorf("error creating bluesky post: %w", err)
+	}
+
+	return ref.URI + handleSep + ref.CID, nil
+}
+
+// UpdateStreamInfo is a no-op since posts can not be edited. Use the delete or repost offline policy to act on the
+// post when a stream ends.
+func (s *Sender) UpdateStreamInfo(_ context.Context, target string, _ string, _ domain.StreamInfo) error {
+	_, err := s.account(target)
+	return err
+}
+
+// DeleteStreamInfo deletes the go-live post.
+func (s *Sender) DeleteStreamInfo(ctx context.Context, target string, messageID string) error {
+	a, err := s.account(target)
+	if err != nil {
+		return err
+	}
+
+	parent, err := parseHandle(messageID)
+	if err != nil {
+		return err
+	}
+
+	did, err := s.did(ctx, a)
+	if err != nil {
+		return err
+	}
+
+	err = s.call(ctx, a, deleteRecordPath, map[string]any{
+		"repo":       did,
+		"collection": postCollection,
+		"rkey":       parent.URI[strings.LastIndex(parent.URI, "/")+1:],
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting bluesky post: %w", err)
+	}
+
+	return nil
+}
+
+// ReplyStreamInfo creates a "stream ended" post in reply to the go-live post and returns the handle of the reply.
+func (s *Sender) ReplyStreamInfo(ctx context.Context,
+	target string,
+	messageID string,
+	stream domain.StreamInfo) (string, error) {
+	a, err := s.account(target)
+	if err != nil {
+		return "", err
+	}
+
+	parent, err := parseHandle(messageID)
+	if err != nil {
+		return "", err
+	}
+
+	did, err := s.did(ctx, a)
+	if err != nil {
+		return "", err
+	}
+
+	text := "❌ " + stream.Username + " was streaming " + stream.Title
+	record := a.newPost(truncate(text, maxPostLength), "")
+	record["reply"] = map[string]any{"root": parent, "parent": parent}
+
+	var ref strongRef
+	err = s.call(ctx, a, createRecordPath, map[string]any{
+		"repo":       did,
+		"collection": postCollection,
+		"record":     record,
+	}, &ref)
+	if err != nil {
+		return "", fmt.Errorf("error replying to bluesky post: %w", err)
+	}
+
+	return ref.URI + handleSep + ref.CID, nil
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindBluesky
+}
+
+func (s *Sender) account(target string) (*account, error) {
+	a, ok := s.accounts[strings.ToLower(target)]
+	if !ok {
+		return nil, fmt.Errorf("unknown bluesky account %q", target)
+	}
+	return a, nil
+}
+
+// parseHandle splits a message handle into the reference of the post.
+func parseHandle(messageID string) (strongRef, error) {
+	uri, cid, found := strings.Cut(messageID, handleSep)
+	if !found {
+		return strongRef{}, fmt.Errorf("invalid bluesky post handle %q", messageID)
+	}
+	return strongRef{URI: uri, CID: cid}, nil
+}
+
+// newPost builds a post record, adding a link facet for the last occurrence of link in the text.
+func (a *account) newPost(text string, link string) map[string]any {
+	record := map[string]any{
+		"$type":     postCollection,
+		"text":      text,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if a.Language != "" {
+		record["langs"] = []string{a.Language}
+	}
+
+	// facet indices are byte offsets of the UTF-8 encoded text
+	if start := strings.LastIndex(text, link); link != "" && start >= 0 {
+		record["facets"] = []map[string]any{{
+			"index":    map[string]int{"byteStart": start, "byteEnd": start + len(link)},
+			"features": []map[string]string{{"$type": linkFacet, "uri": link}},
+		}}
+	}
+
+	return record
+}
+
+// did returns the DID of the account, logging in if there is no session yet. The DID is kept when a session is
+// renewed, so it can be used to build requests before sending them.
+func (s *Sender) did(ctx context.Context, a *account) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.session.AccessJwt == "" {
+		err := s.login(ctx, a)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return a.session.DID, nil
+}
+
+// uploadThumbnail fetches a thumbnail and uploads it as blob, returning the blob reference.
+func (s *Sender) uploadThumbnail(ctx context.Context, a *account, url string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building thumbnail request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching thumbnail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response fetching thumbnail: %d", resp.StatusCode)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading thumbnail: %w", err)
+	}
+	if len(image) > maxImageSize {
+		return nil, errors.New("thumbnail exceeds the bluesky blob size limit")
+	}
+
+	var response struct {
+		Blob json.RawMessage `json:"blob"`
+	}
+	err = s.send(ctx, a, uploadBlobPath, http.DetectContentType(image), image, &response)
+	if err != nil {
+		return nil, fmt.Errorf("error uploading bluesky blob: %w", err)
+	}
+
+	return response.Blob, nil
+}
+
+// call sends a JSON procedure call to the PDS.
+func (s *Sender) call(ctx context.Context, a *account, path string, body any, result any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding bluesky request: %w", err)
+	}
+
+	return s.send(ctx, a, path, mimeType, b, result)
+}
+
+// send makes an authenticated request, creating a new session if there is none or the current one expired.
+func (s *Sender) send(ctx context.Context, a *account, path string, contentType string, body []byte, result any) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.session.AccessJwt == "" {
+		err := s.login(ctx, a)
+		if err != nil {
+			return err
+		}
+	}
+
+	errResp, err := s.post(ctx, a, path, contentType, body, result)
+	if errResp.Error == expiredToken {
+		log.Debug().Str("account", a.Identifier).Msg("bluesky session expired, logging in")
+		err = s.login(ctx, a)
+		if err != nil {
+			return err
+		}
+		_, err = s.post(ctx, a, path, contentType, body, result)
+	}
+
+	return err
+}
+
+func (s *Sender) login(ctx context.Context, a *account) error {
+	body, err := json.Marshal(map[string]string{"identifier": a.Identifier, "password": a.Password})
+	if err != nil {
+		return fmt.Errorf("error encoding bluesky login: %w", err)
+	}
+
+	a.session = session{}
+	var created session
+	_, err = s.post(ctx, a, createSessionPath, mimeType, body, &created)
+	if err != nil {
+		return fmt.Errorf("error creating bluesky session: %w", err)
+	}
+
+	a.session = created
+
+	return nil
+}
+
+func (s *Sender) post(ctx context.Context,
+	a *account,
+	path string,
+	contentType string,
+	body []byte,
+	result any) (errorResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Server+path, bytes.NewReader(body))
+	if err != nil {
+		return errorResponse{}, fmt.Errorf("error building request for bluesky: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if a.session.AccessJwt != "" {
+		req.Header.Set("Authorization", "Bearer "+a.session.AccessJwt)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errorResponse{}, fmt.Errorf("error making request to bluesky: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return errResp, fmt.Errorf("unexpected response from bluesky: %d %s %s",
+			resp.StatusCode, errResp.Error, errResp.Message)
+	}
+
+	if result == nil {
+		return errorResponse{}, nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return errorResponse{}, fmt.Errorf("error decoding response from bluesky: %w", err)
+	}
+
+	return errorResponse{}, nil
+}
+
+// truncate shortens text to a maximum number of runes, marking the cut with an ellipsis.
+func truncate(text string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
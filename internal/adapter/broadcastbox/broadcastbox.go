@@ -17,7 +17,10 @@ const (
 	apiURL = "/api/status"
 )
 
-type StreamInfoProvider struct{}
+type StreamInfoProvider struct {
+	// Metrics optionally records the HTTP responses of the broadcastbox instances.
+	Metrics port.Metrics
+}
 
 var _ = (*port.StreamInfoProvider)(nil)
 
@@ -31,7 +34,9 @@ type broadcastboxResponse struct {
 	} `json:"whepSessions"`
 }
 
-func checkOnline(ctx context.Context, stream domain.StreamQuery, client *http.Client) (bool, int, error) {
+func (s *StreamInfoProvider) checkOnline(ctx context.Context,
+	stream domain.StreamQuery,
+	client *http.Client) (bool, int, error) {
 	url := stream.BaseURL + apiURL
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -42,6 +47,7 @@ func checkOnline(ctx context.Context, stream domain.StreamQuery, client *http.Cl
 	if err != nil {
 		return false, 0, fmt.Errorf("get stream online request failed: %w", err)
 	}
+	s.observeResponse(resp.StatusCode)
 	defer resp.Body.Close()
 
 	var respBody []broadcastboxResponse
@@ -55,9 +61,9 @@ func checkOnline(ctx context.Context, stream domain.StreamQuery, client *http.Cl
 		return false, 0, fmt.Errorf("error decoding response body: %w", err)
 	}
 
-	for _, s := range respBody {
-		if s.StreamKey == stream.UserID && len(s.VideoStreams) > 0 {
-			return true, len(s.WhepSessions), nil
+	for _, status := range respBody {
+		if status.StreamKey == stream.UserID && len(status.VideoStreams) > 0 {
+			return true, len(status.WhepSessions), nil
 		}
 	}
 
@@ -77,11 +83,12 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 
 	client := &http.Client{}
 
+	failed := make(domain.StreamErrors)
 	for _, stream := range streams {
-		on, viewers, err := checkOnline(ctx, *stream, client)
+		on, viewers, err := s.checkOnline(ctx, *stream, client)
 		if err != nil {
-			errorCh <- fmt.Errorf("error checking if stream %s is online: %w", stream.UserID, err)
-			return
+			failed[*stream] = fmt.Errorf("error checking if stream is online: %w", err)
+			continue
 		}
 
 		if on {
@@ -108,8 +115,18 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 	}
 
 	infos <- streamInfos
+	if len(failed) > 0 {
+		errorCh <- failed
+	}
 }
 
 func (s *StreamInfoProvider) Kind() domain.StreamKind {
 	return domain.StreamKindBroadcastBox
 }
+
+// observeResponse records the status code of a response if metrics are set.
+func (s *StreamInfoProvider) observeResponse(status int) {
+	if s.Metrics != nil {
+		s.Metrics.ObserveHTTPResponse(s.Kind(), status)
+	}
+}
@@ -0,0 +1,598 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SecurityNone     = "none"
+	SecuritySTARTTLS = "starttls"
+	SecurityTLS      = "tls"
+
+	DefaultBatchWindow = 5 * time.Second
+	DefaultTimeout     = 30 * time.Second
+
+	liveTemplate    = "live"
+	offlineTemplate = "offline"
+
+	maxImageSize  = 5 << 20
+	maxLineLength = 76
+	randomIDBytes = 16
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Config holds the SMTP server settings, the target of a notification is the recipient address.
+type Config struct {
+	// Host and Port of the SMTP server.
+	Host string
+	Port int
+	// Username and Password enable PLAIN authentication when set, only permitted over TLS or to localhost.
+	Username string
+	Password string
+	// From is the sender address, optionally with a display name.
+	From string
+	// Security is one of none, starttls or tls (implicit TLS).
+	Security string
+	// OfflineMail sends a "stream ended" mail replying to the go-live mail.
+	OfflineMail bool
+	// BatchWindow is the time to wait for further streams starting in the same poll before sending a go-live mail.
+	BatchWindow time.Duration
+	// Timeout limits fetching thumbnails and delivering a mail.
+	Timeout time.Duration
+	// TemplateDir optionally overrides the built-in live.html, live.txt, offline.html and offline.txt templates.
+	TemplateDir string
+}
+
+type Sender struct {
+	config Config
+	from   *mail.Address
+	client *http.Client
+
+	// rootCAs overrides the system certificate pool when verifying the SMTP server
+	rootCAs *x509.CertPool
+
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+
+	mu      sync.Mutex
+	pending map[string]*batch
+	// report is called when a batched go-live mail could not be sent, nil if unset
+	report func(target string, messageID string, err error)
+}
+
+var (
+	_ port.Notifier         = (*Sender)(nil)
+	_ port.DeliveryReporter = (*Sender)(nil)
+)
+
+// batch collects the go-live notifications for a recipient until the batch window closes.
+type batch struct {
+	id      string
+	streams []domain.StreamInfo
+}
+
+type mailData struct {
+	Streams []mailStream
+}
+
+type mailStream struct {
+	domain.StreamInfo
+	// ImageCID references the inline thumbnail attachment, empty if none could be fetched
+	ImageCID string
+}
+
+type inlineImage struct {
+	cid         string
+	contentType string
+	data        []byte
+}
+
+func NewEmailSender(config Config) (*Sender, error) {
+	if config.Host == "" || config.Port == 0 {
+		return nil, errors.New("smtp host and port must be set")
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+
+	switch config.Security {
+	case "":
+		config.Security = SecuritySTARTTLS
+	case SecurityNone, SecuritySTARTTLS, SecurityTLS:
+	default:
+		return nil, fmt.Errorf("invalid smtp security %q, expected none, starttls or tls", config.Security)
+	}
+
+	if config.BatchWindow <= 0 {
+		config.BatchWindow = DefaultBatchWindow
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	var templates fs.FS
+	if config.TemplateDir != "" {
+		templates = os.DirFS(config.TemplateDir)
+	} else {
+		templates, err = fs.Sub(defaultTemplates, "templates")
+		if err != nil {
+			return nil, fmt.Errorf("error reading built-in mail templates: %w", err)
+		}
+	}
+
+	s := &Sender{
+		config:  config,
+		from:    from,
+		client:  &http.Client{},
+		html:    make(map[string]*htmltemplate.Template),
+		text:    make(map[string]*texttemplate.Template),
+		pending: make(map[string]*batch),
+	}
+
+	for _, name := range []string{liveTemplate, offlineTemplate} {
+		s.html[name], err = htmltemplate.ParseFS(templates, name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing mail template %s.html: %w", name, err)
+		}
+		s.text[name], err = texttemplate.ParseFS(templates, name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing mail template %s.txt: %w", name, err)
+		}
+	}
+
+	return s, nil
+}
+
+// SendStreamInfo adds a domain.StreamInfo to the pending go-live mail of a recipient and returns its message ID
+// right away, the mail is sent in the background once the batch window closes and failures are passed to the
+// OnDeliveryFailed callback. All streams of a batch share the same message ID.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.pending[target]
+	if !ok {
+		id, err := s.messageID()
+		if err != nil {
+			return "", err
+		}
+
+		b = &batch{id: id}
+		s.pending[target] = b
+		go s.schedule(ctx, target, b)
+	}
+	b.streams = append(b.streams, stream)
+
+	return b.id, nil
+}
+
+// UpdateStreamInfo sends a "stream ended" mail in reply to the go-live mail if enabled, updates of live streams
+// are skipped since mails can not be edited.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	if stream.IsOnline || !s.config.OfflineMail {
+		log.Debug().Str("recipient", target).Msg("mails can not be edited, skipping update")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	id, err := s.messageID()
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail(ctx, target, offlineTemplate, []domain.StreamInfo{stream}, id, messageID)
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindEmail
+}
+
+// OnDeliveryFailed sets the callback reporting batched go-live mails that could not be sent or were discarded.
+func (s *Sender) OnDeliveryFailed(report func(target string, messageID string, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = report
+}
+
+// schedule sends the batch once the batch window closes, the batch is discarded if the context is cancelled first.
+func (s *Sender) schedule(ctx context.Context, target string, b *batch) {
+	timer := time.NewTimer(s.config.BatchWindow)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		s.flush(ctx, target, b)
+	case <-ctx.Done():
+		streams := s.take(target, b)
+		log.Warn().Err(ctx.Err()).Str("recipient", target).Int("streams", len(streams)).
+			Msg("discarding batched go-live mail")
+		s.failed(target, b.id, fmt.Errorf("error sending go-live mail: %w", ctx.Err()))
+	}
+}
+
+func (s *Sender) flush(ctx context.Context, target string, b *batch) {
+	streams := s.take(target, b)
+
+	log.Debug().Str("recipient", target).Int("streams", len(streams)).Msg("sending batched go-live mail")
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	err := s.sendMail(ctx, target, liveTemplate, streams, b.id, "")
+	if err != nil {
+		log.Error().Err(err).Str("recipient", target).Str("id", b.id).Msg("failed to send go-live mail")
+		s.failed(target, b.id, err)
+	}
+}
+
+// failed passes the error of a batch to the delivery callback if set.
+func (s *Sender) failed(target string, id string, err error) {
+	s.mu.Lock()
+	report := s.report
+	s.mu.Unlock()
+
+	if report != nil {
+		report(target, id, err)
+	}
+}
+
+// take removes a batch from the pending mails and returns its streams.
+func (s *Sender) take(target string, b *batch) []domain.StreamInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending[target] == b {
+		delete(s.pending, target)
+	}
+
+	return b.streams
+}
+
+// sendMail renders a template for the streams, fetches their thumbnails and delivers the mail.
+func (s *Sender) sendMail(ctx context.Context,
+	recipient string,
+	name string,
+	streams []domain.StreamInfo,
+	id string,
+	inReplyTo string) error {
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address %q: %w", recipient, err)
+	}
+
+	data := mailData{Streams: make([]mailStream, len(streams))}
+	images := make([]inlineImage, 0)
+	for i, stream := range streams {
+		data.Streams[i].StreamInfo = stream
+		if name != liveTemplate || stream.ThumbnailURL == "" {
+			continue
+		}
+
+		image, err := s.fetchImage(ctx, stream.ThumbnailURL)
+		if err != nil {
+			log.Warn().Err(err).Str("stream", stream.Username).Msg("failed to fetch thumbnail, sending without")
+			continue
+		}
+		image.cid = fmt.Sprintf("thumbnail-%d@streamobserver", i)
+		data.Streams[i].ImageCID = image.cid
+		images = append(images, image)
+	}
+
+	msg, err := s.compose(to, subject(name, streams), id, inReplyTo, name, data, images)
+	if err != nil {
+		return err
+	}
+
+	err = s.deliver(ctx, to.Address, msg)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Str("recipient", to.Address).Str("id", id).Msg("sent mail")
+
+	return nil
+}
+
+func subject(name string, streams []domain.StreamInfo) string {
+	switch {
+	case name == offlineTemplate:
+		return "❌ " + streams[0].Username + " stream ended"
+	case len(streams) == 1:
+		return "🔴 " + streams[0].Username + " is live"
+	default:
+		names := make([]string, len(streams))
+		for i, stream := range streams {
+			names[i] = stream.Username
+		}
+		return "🔴 " + strings.Join(names, ", ") + " are live"
+	}
+}
+
+// compose builds a multipart/alternative mail with a text part and a multipart/related HTML part holding the
+// inline images.
+func (s *Sender) compose(to *mail.Address,
+	subject string,
+	id string,
+	inReplyTo string,
+	name string,
+	data mailData,
+	images []inlineImage) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	alternative := multipart.NewWriter(buf)
+
+	header := [][2]string{
+		{"From", s.from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", id},
+	}
+	if inReplyTo != "" {
+		header = append(header, [2]string{"In-Reply-To", inReplyTo}, [2]string{"References", inReplyTo})
+	}
+	header = append(header,
+		[2]string{"MIME-Version", "1.0"},
+		[2]string{"Content-Type", "multipart/alternative; boundary=" + alternative.Boundary()})
+	for _, field := range header {
+		buf.WriteString(field[0] + ": " + field[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	text := new(bytes.Buffer)
+	err := s.text[name].Execute(text, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering mail template %s.txt: %w", name, err)
+	}
+	err = writeQuotedPrintable(alternative, "text/plain; charset=utf-8", text.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	related := new(bytes.Buffer)
+	relatedWriter := multipart.NewWriter(related)
+
+	html := new(bytes.Buffer)
+	err = s.html[name].Execute(html, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering mail template %s.html: %w", name, err)
+	}
+	err = writeQuotedPrintable(relatedWriter, "text/html; charset=utf-8", html.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range images {
+		err = writeImage(relatedWriter, image)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = relatedWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error closing mail part: %w", err)
+	}
+
+	part, err := alternative.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + relatedWriter.Boundary()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating mail part: %w", err)
+	}
+	_, err = part.Write(related.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error writing mail part: %w", err)
+	}
+
+	err = alternative.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error closing mail: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w *multipart.Writer, contentType string, body []byte) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating mail part: %w", err)
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	_, err = qp.Write(body)
+	if err != nil {
+		return fmt.Errorf("error writing mail part: %w", err)
+	}
+
+	err = qp.Close()
+	if err != nil {
+		return fmt.Errorf("error writing mail part: %w", err)
+	}
+
+	return nil
+}
+
+func writeImage(w *multipart.Writer, image inlineImage) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {image.contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Id":                {"<" + image.cid + ">"},
+		"Content-Disposition":       {"inline"},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating mail image part: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(image.data)
+	for len(encoded) > 0 {
+		n := min(maxLineLength, len(encoded))
+		_, err = io.WriteString(part, encoded[:n]+"\r\n")
+		if err != nil {
+			return fmt.Errorf("error writing mail image part: %w", err)
+		}
+		encoded = encoded[n:]
+	}
+
+	return nil
+}
+
+// fetchImage downloads a thumbnail to be embedded into the mail.
+func (s *Sender) fetchImage(ctx context.Context, url string) (inlineImage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return inlineImage{}, fmt.Errorf("error building thumbnail request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return inlineImage{}, fmt.Errorf("error fetching thumbnail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return inlineImage{}, fmt.Errorf("unexpected response fetching thumbnail: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize))
+	if err != nil {
+		return inlineImage{}, fmt.Errorf("error reading thumbnail: %w", err)
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return inlineImage{}, fmt.Errorf("thumbnail has unexpected content type %s", contentType)
+	}
+
+	return inlineImage{contentType: contentType, data: data}, nil
+}
+
+func (s *Sender) messageID() (string, error) {
+	b := make([]byte, randomIDBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating message id: %w", err)
+	}
+
+	host := "streamobserver"
+	if _, h, found := strings.Cut(s.from.Address, "@"); found {
+		host = h
+	}
+
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(b), time.Now().Unix(), host), nil
+}
+
+// deliver connects to the SMTP server according to the security setting and sends the mail.
+func (s *Sender) deliver(ctx context.Context, recipient string, msg []byte) error {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host, RootCAs: s.rootCAs, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	var err error
+	if s.config.Security == SecurityTLS {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to smtp server: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("error setting smtp deadline: %w", err)
+		}
+	}
+
+	c, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error creating smtp client: %w", err)
+	}
+	defer c.Close()
+
+	if s.config.Security == SecuritySTARTTLS {
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			return fmt.Errorf("error starting tls: %w", err)
+		}
+	}
+
+	if s.config.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host))
+		if err != nil {
+			return fmt.Errorf("error authenticating with smtp server: %w", err)
+		}
+	}
+
+	err = c.Mail(s.from.Address)
+	if err != nil {
+		return fmt.Errorf("error setting mail sender: %w", err)
+	}
+	err = c.Rcpt(recipient)
+	if err != nil {
+		return fmt.Errorf("error setting mail recipient: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error starting mail data: %w", err)
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("error writing mail data: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("error finishing mail data: %w", err)
+	}
+
+	err = c.Quit()
+	if err != nil {
+		return fmt.Errorf("error closing smtp session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,550 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"streamobserver/internal/core/domain"
+)
+
+const testTimeout = 5 * time.Second
+
+var thumbnail = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+// received is a mail accepted by the SMTP stub.
+type received struct {
+	from string
+	to   []string
+	data []byte
+	// tls reports whether the session was encrypted when the mail was sent
+	tls bool
+	// auth holds the decoded AUTH PLAIN credentials, empty if the client did not authenticate
+	auth string
+}
+
+// smtpStub is a minimal SMTP server supporting STARTTLS, implicit TLS and AUTH PLAIN.
+type smtpStub struct {
+	listener net.Listener
+	tls      *tls.Config
+	implicit bool
+	mails    chan received
+}
+
+func newSMTPStub(t *testing.T, implicit bool) (*smtpStub, *x509.CertPool) {
+	t.Helper()
+
+	cert, pool := newCertificate(t)
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	if implicit {
+		listener = tls.NewListener(listener, config)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &smtpStub{listener: listener, tls: config, implicit: implicit, mails: make(chan received, 10)}
+	go stub.serve()
+
+	return stub, pool
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	encrypted := s.implicit
+	text := textproto.NewConn(conn)
+	mail := received{}
+
+	reply := func(line string) bool {
+		return text.PrintfLine("%s", line) == nil
+	}
+
+	if !reply("220 stub ESMTP") {
+		return
+	}
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"250-stub"}
+			if !encrypted {
+				lines = append(lines, "250-STARTTLS")
+			} else {
+				lines = append(lines, "250-AUTH PLAIN")
+			}
+			lines = append(lines, "250 8BITMIME")
+			for _, l := range lines {
+				reply(l)
+			}
+		case "STARTTLS":
+			reply("220 ready to start tls")
+			tlsConn := tls.Server(conn, s.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			encrypted = true
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			credentials, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				reply("501 invalid credentials")
+				continue
+			}
+			mail.auth = string(credentials)
+			reply("235 authenticated")
+		case "MAIL":
+			mail.from = address(arg)
+			reply("250 ok")
+		case "RCPT":
+			mail.to = append(mail.to, address(arg))
+			reply("250 ok")
+		case "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = data
+			mail.tls = encrypted
+			s.mails <- mail
+			mail = received{auth: mail.auth}
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// address extracts the address of a MAIL FROM or RCPT TO argument, ignoring any parameters.
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, "<")
+	addr, _, _ = strings.Cut(addr, ">")
+	return addr
+}
+
+// next waits for the next mail accepted by the stub.
+func (s *smtpStub) next(t *testing.T) received {
+	t.Helper()
+
+	select {
+	case m := <-s.mails:
+		return m
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for mail")
+		return received{}
+	}
+}
+
+func newCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: parsed}, pool
+}
+
+func newTestSender(t *testing.T, stub *smtpStub, pool *x509.CertPool, config Config) *Sender {
+	t.Helper()
+
+	config.Host = "127.0.0.1"
+	config.Port = stub.port()
+	config.From = "Streamobserver <observer@example.com>"
+	config.BatchWindow = 10 * time.Millisecond
+	config.Timeout = testTimeout
+
+	s, err := NewEmailSender(config)
+	if err != nil {
+		t.Fatalf("error creating sender: %v", err)
+	}
+	s.rootCAs = pool
+
+	return s
+}
+
+func newThumbnailServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(thumbnail)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func testStream(username string, thumbnailURL string) domain.StreamInfo {
+	return domain.StreamInfo{
+		Username:     username,
+		Title:        "Testing",
+		URL:          "https://example.com/" + username,
+		ThumbnailURL: thumbnailURL,
+		IsOnline:     true,
+	}
+}
+
+// mailPart is a decoded leaf part of a mail.
+type mailPart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// parseMail returns the top level headers of a mail and the parts of its multipart body in order, nested
+// multipart parts are flattened with their content type recorded in types.
+func parseMail(t *testing.T, data []byte) (*mail.Message, []string, []mailPart) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("error reading mail: %v", err)
+	}
+
+	types := make([]string, 0)
+	parts := make([]mailPart, 0)
+
+	var walk func(contentType string, body io.Reader)
+	walk = func(contentType string, body io.Reader) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("error parsing content type %q: %v", contentType, err)
+		}
+		types = append(types, mediaType)
+
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("error reading mail part: %v", err)
+			}
+			parts = append(parts, mailPart{body: b})
+			return
+		}
+
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatalf("error reading mail part: %v", err)
+			}
+
+			before := len(parts)
+			walk(part.Header.Get("Content-Type"), part)
+			if len(parts) == before+1 {
+				parts[before].header = part.Header
+			}
+		}
+	}
+	walk(msg.Header.Get("Content-Type"), msg.Body)
+
+	return msg, types, parts
+}
+
+func decodeBase64(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(body)))
+	if err != nil {
+		t.Fatalf("error decoding base64: %v", err)
+	}
+
+	return decoded
+}
+
+func TestSendStreamInfo_MultipartAlternative(t *testing.T) {
+	stub, pool := newSMTPStub(t, false)
+	s := newTestSender(t, stub, pool, Config{Security: SecurityNone})
+
+	id, err := s.SendStreamInfo(t.Context(), "viewer@example.com", testStream("alice", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := stub.next(t)
+	if m.from != "observer@example.com" || len(m.to) != 1 || m.to[0] != "viewer@example.com" {
+		t.Errorf("unexpected envelope from %q to %v", m.from, m.to)
+	}
+
+	msg, types, parts := parseMail(t, m.data)
+	if got := msg.Header.Get("Message-ID"); got != id {
+		t.Errorf("expected message id %q, got %q", id, got)
+	}
+
+	expected := []string{"multipart/alternative", "text/plain", "multipart/related", "text/html"}
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected parts %v, got %v", expected, types)
+	}
+	if !strings.Contains(string(parts[0].body), "alice") {
+		t.Errorf("text part does not mention the stream: %q", parts[0].body)
+	}
+	if !strings.Contains(string(parts[1].body), `href="https://example.com/alice"`) {
+		t.Errorf("html part does not link the stream: %q", parts[1].body)
+	}
+}
+
+func TestSendStreamInfo_InlineThumbnail(t *testing.T) {
+	stub, pool := newSMTPStub(t, false)
+	s := newTestSender(t, stub, pool, Config{Security: SecurityNone})
+	server := newThumbnailServer(t)
+
+	_, err := s.SendStreamInfo(t.Context(), "viewer@example.com", testStream("alice", server.URL))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, types, parts := parseMail(t, stub.next(t).data)
+	if len(parts) != 3 || types[len(types)-1] != "image/png" {
+		t.Fatalf("expected text, html and image parts, got %v", types)
+	}
+
+	image := parts[2]
+	cid := strings.Trim(image.header.Get("Content-Id"), "<>")
+	if cid == "" {
+		t.Fatal("image part has no content id")
+	}
+	if !strings.Contains(string(parts[1].body), `src="cid:`+cid+`"`) {
+		t.Errorf("html part does not reference cid %q: %q", cid, parts[1].body)
+	}
+	if image.header.Get("Content-Disposition") != "inline" {
+		t.Errorf("expected inline disposition, got %q", image.header.Get("Content-Disposition"))
+	}
+	if !bytes.Equal(decodeBase64(t, image.body), thumbnail) {
+		t.Error("image part does not hold the thumbnail")
+	}
+}
+
+func TestSendStreamInfo_STARTTLS(t *testing.T) {
+	stub, pool := newSMTPStub(t, false)
+	s := newTestSender(t, stub, pool, Config{Security: SecuritySTARTTLS})
+
+	_, err := s.SendStreamInfo(t.Context(), "viewer@example.com", testStream("alice", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := stub.next(t)
+	if !m.tls {
+		t.Error("expected mail to be sent after STARTTLS")
+	}
+	if m.auth != "" {
+		t.Errorf("expected no authentication, got %q", m.auth)
+	}
+}
+
+func TestSendStreamInfo_ImplicitTLSWithAuth(t *testing.T) {
+	stub, pool := newSMTPStub(t, true)
+	s := newTestSender(t, stub, pool, Config{Security: SecurityTLS, Username: "user", Password: "secret"})
+
+	_, err := s.SendStreamInfo(t.Context(), "viewer@example.com", testStream("alice", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := stub.next(t)
+	if !m.tls {
+		t.Error("expected mail to be sent over tls")
+	}
+	if m.auth != "\x00user\x00secret" {
+		t.Errorf("unexpected credentials %q", m.auth)
+	}
+}
+
+func TestSendStreamInfo_Batch(t *testing.T) {
+	stub, pool := newSMTPStub(t, false)
+	s := newTestSender(t, stub, pool, Config{Security: SecurityNone})
+	s.config.BatchWindow = 100 * time.Millisecond
+
+	ids := make(map[string]string)
+	for _, recipient := range []string{"first@example.com", "second@example.com"} {
+		for _, username := range []string{"alice", "bob"} {
+			id, err := s.SendStreamInfo(t.Context(), recipient, testStream(username, ""))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if previous, ok := ids[recipient]; ok && previous != id {
+				t.Errorf("expected streams of a batch to share message id, got %q and %q", previous, id)
+			}
+			ids[recipient] = id
+		}
+	}
+	if ids["first@example.com"] == ids["second@example.com"] {
+		t.Error("expected recipients to get distinct message ids")
+	}
+
+	decoder := new(mime.WordDecoder)
+	for range 2 {
+		m := stub.next(t)
+		msg, _, _ := parseMail(t, m.data)
+
+		if got := msg.Header.Get("Message-ID"); got != ids[m.to[0]] {
+			t.Errorf("expected message id %q for %s, got %q", ids[m.to[0]], m.to[0], got)
+		}
+		subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+		if err != nil {
+			t.Fatalf("error decoding subject: %v", err)
+		}
+		if !strings.Contains(subject, "alice, bob") {
+			t.Errorf("expected both streams in subject, got %q", subject)
+		}
+	}
+
+	select {
+	case m := <-stub.mails:
+		t.Errorf("unexpected additional mail to %v", m.to)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSendStreamInfo_DoesNotBlock(t *testing.T) {
+	stub, pool := newSMTPStub(t, false)
+	s := newTestSender(t, stub, pool, Config{Security: SecurityNone})
+	s.config.BatchWindow = time.Hour
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := s.SendStreamInfo(ctx, "viewer@example.com", testStream("alice", ""))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("SendStreamInfo blocked for the batch window")
+	}
+
+	cancel()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		s.mu.Lock()
+		pending := len(s.pending)
+		s.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cancelled batch was not discarded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case m := <-stub.mails:
+		t.Errorf("unexpected mail to %v after cancellation", m.to)
+	default:
+	}
+}
+
+func TestSendStreamInfo_ReportsFailure(t *testing.T) {
+	stub, pool := newSMTPStub(t, false)
+	s := newTestSender(t, stub, pool, Config{Security: SecurityNone})
+	// nothing listens once the stub is closed
+	stub.listener.Close()
+
+	type failure struct {
+		target string
+		id     string
+		err    error
+	}
+	failures := make(chan failure, 1)
+	s.OnDeliveryFailed(func(target string, messageID string, err error) {
+		failures <- failure{target: target, id: messageID, err: err}
+	})
+
+	id, err := s.SendStreamInfo(t.Context(), "viewer@example.com", testStream("alice", ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case f := <-failures:
+		if f.target != "viewer@example.com" || f.id != id {
+			t.Errorf("expected failure of %q to viewer@example.com, got %q to %q", id, f.id, f.target)
+		}
+		if f.err == nil {
+			t.Error("expected failure to carry an error")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for delivery failure")
+	}
+}
@@ -0,0 +1,188 @@
+package gotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	messagePath     = "/message"
+	tokenHeader     = "X-Gotify-Key"
+	mimeType        = "application/json"
+	markdownType    = "text/markdown"
+	displayExtra    = "client::display"
+	notifyExtra     = "client::notification"
+	defaultPriority = 5
+)
+
+// Config holds the settings of a Gotify server, the target of a notification is the name of an application.
+type Config struct {
+	// Server is the base URL of the Gotify server.
+	Server string
+	// Applications maps names used as notification targets to application tokens.
+	Applications map[string]string
+	// Priority is the message priority, 0 uses the default of 5.
+	Priority int
+	// Markdown renders messages as markdown in the Gotify clients.
+	Markdown bool
+	// OfflineNotice sends a separate message when a stream ends, Gotify messages can not be edited.
+	OfflineNotice bool
+}
+
+type Sender struct {
+	config Config
+	client *http.Client
+}
+
+var _ port.Notifier = (*Sender)(nil)
+
+type messageRequest struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras,omitempty"`
+}
+
+type messageResponse struct {
+	ID int `json:"id"`
+}
+
+func NewGotifySender(config Config) (*Sender, error) {
+	if config.Server == "" {
+		return nil, errors.New("gotify server is not set")
+	}
+	if len(config.Applications) == 0 {
+		return nil, errors.New("no gotify applications configured")
+	}
+	if config.Priority == 0 {
+		config.Priority = defaultPriority
+	}
+	config.Server = strings.TrimSuffix(config.Server, "/")
+
+	applications := make(map[string]string, len(config.Applications))
+	for name, token := range config.Applications {
+		applications[strings.ToLower(name)] = token
+	}
+	config.Applications = applications
+
+	return &Sender{config: config, client: &http.Client{}}, nil
+}
+
+// SendStreamInfo sends a go-live message for a domain.StreamInfo to an application.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	var viewerInfo string
+	if stream.ViewerCount > -1 {
+		viewerInfo = fmt.Sprintf(" for %d viewers", stream.ViewerCount)
+	}
+
+	var message string
+	if s.config.Markdown {
+		message = fmt.Sprintf("**%s** is streaming %s%s\n\n[%s](%s)",
+			stream.Username, stream.Title, viewerInfo, stream.URL, stream.URL)
+		if stream.ThumbnailURL != "" {
+			message += fmt.Sprintf("\n\n![thumbnail](%s)", stream.ThumbnailURL)
+		}
+	} else {
+		message = fmt.Sprintf("%s is streaming %s%s\n%s", stream.Username, stream.Title, viewerInfo, stream.URL)
+	}
+
+	return s.send(ctx, target, stream, messageRequest{
+		Title:    "🔴 " + stream.Username + " is live",
+		Message:  message,
+		Priority: s.config.Priority,
+	})
+}
+
+// UpdateStreamInfo sends an offline notice if enabled, updates of live streams are skipped since Gotify
+// messages can not be edited.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	if stream.IsOnline || !s.config.OfflineNotice {
+		log.Debug().Str("app", target).Str("message", messageID).Msg("gotify does not support edits, skipping update")
+		return nil
+	}
+
+	message := fmt.Sprintf("%s was streaming %s", stream.Username, stream.Title)
+	if s.config.Markdown {
+		message = fmt.Sprintf("**%s** was streaming %s", stream.Username, stream.Title)
+	}
+
+	_, err := s.send(ctx, target, stream, messageRequest{
+		Title:    "❌ " + stream.Username + " is offline",
+		Message:  message,
+		Priority: s.config.Priority,
+	})
+
+	return err
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindGotify
+}
+
+func (s *Sender) send(ctx context.Context,
+	target string,
+	stream domain.StreamInfo,
+	message messageRequest) (string, error) {
+	token, ok := s.config.Applications[strings.ToLower(target)]
+	if !ok {
+		return "", fmt.Errorf("unknown gotify application %q", target)
+	}
+
+	message.Extras = map[string]any{}
+	if s.config.Markdown {
+		message.Extras[displayExtra] = map[string]any{"contentType": markdownType}
+	}
+	notification := map[string]any{}
+	if stream.URL != "" {
+		notification["click"] = map[string]any{"url": stream.URL}
+	}
+	if stream.ThumbnailURL != "" && stream.IsOnline {
+		notification["bigImageUrl"] = stream.ThumbnailURL
+	}
+	if len(notification) > 0 {
+		message.Extras[notifyExtra] = notification
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("error encoding gotify message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Server+messagePath, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error building request for gotify: %w", err)
+	}
+
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set(tokenHeader, token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request to gotify: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from gotify: %d", resp.StatusCode)
+	}
+
+	var response messageResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", fmt.Errorf("error decoding response from gotify: %w", err)
+	}
+
+	log.Debug().Str("app", target).Int("id", response.ID).Msg("sent gotify message")
+
+	return strconv.Itoa(response.ID), nil
+}
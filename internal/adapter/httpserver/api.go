@@ -0,0 +1,310 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxBodySize limits the size of request bodies.
+const maxBodySize = 64 << 10
+
+type streamResponse struct {
+	Kind      domain.StreamKind  `json:"kind"`
+	ID        string             `json:"id"`
+	BaseURL   string             `json:"base_url,omitempty"`
+	CustomURL string             `json:"custom_url,omitempty"`
+	Info      *infoResponse      `json:"latest_info"`
+	Session   *sessionResponse   `json:"session"`
+	Observers []observerResponse `json:"observers"`
+	LastPoll  *time.Time         `json:"last_poll"`
+	LastError string             `json:"last_error,omitempty"`
+}
+
+type infoResponse struct {
+	Username     string     `json:"username"`
+	Title        string     `json:"title"`
+	Category     string     `json:"category,omitempty"`
+	URL          string     `json:"url"`
+	VODURL       string     `json:"vod_url,omitempty"`
+	ViewerCount  int        `json:"viewer_count"`
+	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
+	Online       bool       `json:"online"`
+	StartedAt    *time.Time `json:"started_at"`
+}
+
+type sessionResponse struct {
+	StartedAt      time.Time  `json:"started_at"`
+	EndedAt        *time.Time `json:"ended_at"`
+	Duration       float64    `json:"duration_seconds"`
+	PeakViewers    int        `json:"peak_viewers"`
+	AverageViewers int        `json:"average_viewers"`
+}
+
+type observerResponse struct {
+	Target        string               `json:"target"`
+	MessageID     string               `json:"message_id,omitempty"`
+	OfflinePolicy domain.OfflinePolicy `json:"offline_policy"`
+	LastError     string               `json:"last_error,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// HandleAPI serves the state of the observed streams on /api, requiring the token as bearer token unless empty.
+func (s *Server) HandleAPI(status port.StatusReporter, token string) {
+	s.mux.Handle("GET /api/streams", authorize(token, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, streamResponses(status.Streams(r.Context())))
+	}))
+
+	s.mux.Handle("GET /api/streams/{kind}/{id}", authorize(token, func(w http.ResponseWriter, r *http.Request) {
+		stream, err := status.Stream(r.Context(), domain.StreamKind(r.PathValue("kind")), r.PathValue("id"),
+			r.URL.Query().Get("base_url"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, streamResponses([]domain.StreamStatus{stream})[0])
+	}))
+
+	s.mux.Handle("GET /api/chats/{id}", authorize(token, func(w http.ResponseWriter, r *http.Request) {
+		chat, err := domain.ParseTarget(r.PathValue("id"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		streams, err := status.Chat(r.Context(), chat)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, streamResponses(streams))
+	}))
+}
+
+// authorize rejects requests without the bearer token, all requests are allowed if the token is empty.
+func authorize(token string, handler http.HandlerFunc) http.Handler {
+	return authorizeToken(token, false, handler)
+}
+
+// authorizeQuery is authorize also accepting the token as access_token parameter.
+func authorizeQuery(token string, handler http.HandlerFunc) http.Handler {
+	return authorizeToken(token, true, handler)
+}
+
+func authorizeToken(token string, query bool, handler http.HandlerFunc) http.Handler {
+	if token == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found && query {
+			bearer, found = r.URL.Query().Get("access_token"), r.URL.Query().Has("access_token")
+		}
+		if !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="streamobserver"`)
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func streamResponses(statuses []domain.StreamStatus) []streamResponse {
+	responses := make([]streamResponse, 0, len(statuses))
+	for _, status := range statuses {
+		response := streamResponse{
+			Kind:      status.Query.Kind,
+			ID:        status.Query.UserID,
+			BaseURL:   status.Query.BaseURL,
+			CustomURL: status.Query.CustomURL,
+			Observers: make([]observerResponse, 0, len(status.Observers)),
+			LastPoll:  optionalTime(status.LastPoll),
+			LastError: status.LastError,
+		}
+
+		// the latest info is only set once the stream changed
+		if info := status.LatestInfo; info.Query != nil {
+			response.Info = &infoResponse{
+				Username:     info.Username,
+				Title:        info.Title,
+				Category:     info.Category,
+				URL:          info.URL,
+				VODURL:       info.VODURL,
+				ViewerCount:  info.ViewerCount,
+				ThumbnailURL: info.ThumbnailURL,
+				Online:       info.IsOnline,
+				StartedAt:    optionalTime(info.StartedAt),
+			}
+		}
+
+		if session := status.Session; session != nil {
+			response.Session = &sessionResponse{
+				StartedAt:      session.StartedAt,
+				EndedAt:        optionalTime(session.EndedAt),
+				Duration:       session.Duration().Seconds(),
+				PeakViewers:    session.PeakViewers,
+				AverageViewers: session.AverageViewers(),
+			}
+		}
+
+		for _, observer := range status.Observers {
+			response.Observers = append(response.Observers, observerResponse{
+				Target:        observer.Target.String(),
+				MessageID:     observer.MessageID,
+				OfflinePolicy: observer.OfflinePolicy,
+				LastError:     observer.LastError,
+			})
+		}
+
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// writeError answers with the status matching a domain error.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, domain.ErrAmbiguous):
+		status = http.StatusConflict
+	case errors.Is(err, domain.ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.Err(err).Msg("failed to write http response")
+	}
+}
+
+type subscriptionRequest struct {
+	Kind      domain.StreamKind `json:"kind"`
+	ID        string            `json:"id"`
+	BaseURL   string            `json:"base_url"`
+	CustomURL string            `json:"custom_url"`
+	// Topic routes a Telegram chat into a forum topic
+	Topic string `json:"topic"`
+	// Offline is the offline policy, edit if empty
+	Offline string `json:"offline"`
+}
+
+type subscriptionResponse struct {
+	Target    string               `json:"target"`
+	Kind      domain.StreamKind    `json:"kind"`
+	ID        string               `json:"id"`
+	BaseURL   string               `json:"base_url,omitempty"`
+	CustomURL string               `json:"custom_url,omitempty"`
+	Offline   domain.OfflinePolicy `json:"offline"`
+}
+
+// HandleSubscriptions adds and removes the streams of a chat with POST and DELETE on /api/chats/{id}/streams, the
+// stream is given as JSON body. The token is required.
+func (s *Server) HandleSubscriptions(manager port.SubscriptionManager, token string) {
+	s.mux.Handle("POST /api/chats/{id}/streams", authorize(token, func(w http.ResponseWriter, r *http.Request) {
+		subscription, err := parseSubscription(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		err = manager.Subscribe(r.Context(), subscription)
+		if err != nil {
+			log.Debug().Err(err).Stringer("target", subscription.Target).Msg("failed to subscribe")
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, subscriptionResponse{
+			Target:    subscription.Target.String(),
+			Kind:      subscription.Query.Kind,
+			ID:        subscription.Query.UserID,
+			BaseURL:   subscription.Query.BaseURL,
+			CustomURL: subscription.Query.CustomURL,
+			Offline:   subscription.OfflinePolicy,
+		})
+	}))
+
+	s.mux.Handle("DELETE /api/chats/{id}/streams", authorize(token, func(w http.ResponseWriter, r *http.Request) {
+		subscription, err := parseSubscription(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		err = manager.Unsubscribe(r.Context(), subscription.Target, subscription.Query)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// parseSubscription reads the subscription of the chat in the path from the request body.
+func parseSubscription(r *http.Request) (domain.Subscription, error) {
+	target, err := domain.ParseTarget(r.PathValue("id"))
+	if err != nil {
+		return domain.Subscription{}, fmt.Errorf("%w: %w", domain.ErrInvalid, err)
+	}
+
+	var request subscriptionRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&request)
+	if err != nil {
+		return domain.Subscription{}, fmt.Errorf("%w: error decoding request body: %w", domain.ErrInvalid, err)
+	}
+
+	policy, err := domain.ParseOfflinePolicy(request.Offline)
+	if err != nil {
+		return domain.Subscription{}, fmt.Errorf("%w: %w", domain.ErrInvalid, err)
+	}
+
+	if request.Topic != "" {
+		if target.Kind != domain.NotifierKindTelegram || strings.Contains(target.ID, "/") {
+			return domain.Subscription{}, fmt.Errorf("%w: topics are only supported by telegram chats",
+				domain.ErrInvalid)
+		}
+		target.ID += "/" + request.Topic
+	}
+
+	return domain.Subscription{
+		Target: target,
+		Query: domain.StreamQuery{
+			UserID:    request.ID,
+			BaseURL:   request.BaseURL,
+			CustomURL: request.CustomURL,
+			Kind:      request.Kind,
+		},
+		OfflinePolicy: policy,
+	}, nil
+}
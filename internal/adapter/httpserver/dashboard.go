@@ -0,0 +1,130 @@
+package httpserver
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"streamobserver/internal/core/port"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// keepAliveInterval is the interval of comments sent to idle event streams, keeping proxies from closing them.
+const keepAliveInterval = 30 * time.Second
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// Dashboard serves the web dashboard and pushes the state of the streams to it with Server-Sent Events.
+type Dashboard struct {
+	status port.StatusReporter
+
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+var _ port.ChangeListener = (*Dashboard)(nil)
+
+func NewDashboard(status port.StatusReporter) *Dashboard {
+	return &Dashboard{status: status, clients: make(map[chan struct{}]struct{})}
+}
+
+// StreamsChanged signals all connected clients, changes arriving while a client is busy are coalesced.
+func (d *Dashboard) StreamsChanged() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for client := range d.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *Dashboard) subscribe() chan struct{} {
+	client := make(chan struct{}, 1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clients[client] = struct{}{}
+
+	return client
+}
+
+func (d *Dashboard) unsubscribe(client chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.clients, client)
+}
+
+// HandleDashboard serves the dashboard on /dashboard/ and the event stream on /api/events. The event stream requires
+// the token unless empty, given as bearer token or as access_token parameter since browsers can not set headers on
+// event streams.
+func (s *Server) HandleDashboard(dashboard *Dashboard, token string) {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to load dashboard files")
+	}
+
+	s.mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(files)))
+	s.mux.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+
+	s.mux.Handle("GET /api/events", authorizeQuery(token, dashboard.serveEvents))
+}
+
+// serveEvents sends the state of all streams on connect and after every change as "streams" event.
+func (d *Dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "streaming not supported"})
+		return
+	}
+
+	client := d.subscribe()
+	defer d.unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// disables response buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		data, err := json.Marshal(streamResponses(d.status.Streams(r.Context())))
+		if err != nil {
+			log.Err(err).Msg("failed to encode stream event")
+			return
+		}
+
+		_, err = fmt.Fprintf(w, "event: streams\ndata: %s\n\n", data)
+		if err != nil {
+			log.Debug().Err(err).Msg("event stream closed")
+			return
+		}
+		flusher.Flush()
+
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-client:
+				break wait
+			case <-keepAlive.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+"use strict";
+
+const tokenKey = "streamobserver.token";
+
+let streams = [];
+
+const $ = (id) => document.getElementById(id);
+
+function token() {
+  return localStorage.getItem(tokenKey) || "";
+}
+
+function ago(time) {
+  if (!time) {
+    return "never";
+  }
+  const seconds = Math.max(0, Math.round((Date.now() - new Date(time)) / 1000));
+  if (seconds < 60) {
+    return `${seconds}s ago`;
+  }
+  if (seconds < 3600) {
+    return `${Math.floor(seconds / 60)}m ago`;
+  }
+  return `${Math.floor(seconds / 3600)}h ${Math.floor(seconds / 60) % 60}m ago`;
+}
+
+function duration(seconds) {
+  const minutes = Math.floor(seconds / 60);
+  return `${Math.floor(minutes / 60)}h${String(minutes % 60).padStart(2, "0")}m`;
+}
+
+function renderStream(stream) {
+  const node = $("stream").content.firstElementChild.cloneNode(true);
+  const info = stream.latest_info || {};
+  const online = Boolean(info.online);
+
+  node.classList.add(online ? "live" : "offline");
+  node.querySelector(".badge").textContent = online ? "live" : "offline";
+
+  const image = node.querySelector("img");
+  if (info.thumbnail_url) {
+    // thumbnails keep their URL while the image changes
+    const url = new URL(info.thumbnail_url, location.href);
+    url.searchParams.set("t", stream.last_poll || "");
+    image.src = url.toString();
+  } else {
+    image.hidden = true;
+  }
+
+  const name = node.querySelector(".name");
+  name.textContent = info.username || stream.id;
+  if (info.url) {
+    name.href = info.url;
+  } else {
+    name.removeAttribute("href");
+  }
+
+  node.querySelector(".title").textContent = [info.title, info.category].filter(Boolean).join(" · ");
+
+  const meta = [`${stream.kind}${stream.base_url ? " @ " + stream.base_url : ""}`];
+  if (online && info.viewer_count >= 0) {
+    meta.push(`${info.viewer_count} viewers`);
+  }
+  if (stream.session) {
+    meta.push(`${stream.session.ended_at ? "streamed" : "live for"} ${duration(stream.session.duration_seconds)}`);
+  }
+  meta.push(`polled ${ago(stream.last_poll)}`);
+  node.querySelector(".meta").textContent = meta.join(" · ");
+
+  if (stream.last_error) {
+    const error = node.querySelector(".error");
+    error.textContent = stream.last_error;
+    error.hidden = false;
+  }
+
+  const observers = node.querySelector(".observers");
+  for (const observer of stream.observers) {
+    const item = document.createElement("li");
+    item.textContent = observer.target + (observer.message_id ? ` (message ${observer.message_id})` : "");
+    if (observer.last_error) {
+      const error = document.createElement("span");
+      error.className = "error";
+      error.textContent = ` ${observer.last_error}`;
+      item.append(error);
+    }
+    observers.append(item);
+  }
+
+  return node;
+}
+
+function render() {
+  const live = streams.filter((stream) => stream.latest_info && stream.latest_info.online).length;
+  $("summary").textContent = `${streams.length} streams, ${live} live`;
+
+  const sorted = [...streams].sort((a, b) =>
+    Number(Boolean(b.latest_info && b.latest_info.online)) - Number(Boolean(a.latest_info && a.latest_info.online)));
+  $("streams").replaceChildren(...sorted.map(renderStream));
+}
+
+function setConnection(state) {
+  const connection = $("connection");
+  connection.textContent = state;
+  connection.classList.toggle("live", state === "live");
+}
+
+async function connect() {
+  const headers = token() ? {Authorization: `Bearer ${token()}`} : {};
+  const response = await fetch("../api/streams", {headers});
+  if (response.status === 401) {
+    setConnection("unauthorized");
+    $("login").hidden = false;
+    return;
+  }
+  if (!response.ok) {
+    setConnection(`error ${response.status}`);
+    return;
+  }
+  $("login").hidden = true;
+  streams = await response.json();
+  render();
+
+  const query = token() ? `?access_token=${encodeURIComponent(token())}` : "";
+  const events = new EventSource(`../api/events${query}`);
+  events.addEventListener("streams", (event) => {
+    streams = JSON.parse(event.data);
+    render();
+  });
+  events.addEventListener("open", () => setConnection("live"));
+  events.addEventListener("error", () => setConnection("reconnecting"));
+}
+
+$("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  localStorage.setItem(tokenKey, $("token").value);
+  connect();
+});
+
+// keeps the relative times current between events
+setInterval(render, 10000);
+
+connect().catch((error) => setConnection(`error: ${error.message}`));
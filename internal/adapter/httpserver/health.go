@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type healthResponse struct {
+	Status domain.HealthStatus `json:"status"`
+	Checks []healthCheck       `json:"checks"`
+}
+
+type healthCheck struct {
+	Name    string              `json:"name"`
+	Status  domain.HealthStatus `json:"status"`
+	Message string              `json:"message,omitempty"`
+	Time    *time.Time          `json:"time,omitempty"`
+}
+
+// HandleHealth serves the liveness report on /healthz and the readiness report on /readyz, failing reports are
+// answered with 503.
+func (s *Server) HandleHealth(reporter port.HealthReporter) {
+	s.mux.HandleFunc("GET /healthz", healthHandler(reporter.Liveness))
+	s.mux.HandleFunc("GET /readyz", healthHandler(reporter.Readiness))
+}
+
+func healthHandler(report func(ctx context.Context) domain.HealthReport) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		health := report(r.Context())
+
+		response := healthResponse{Status: health.Status, Checks: make([]healthCheck, 0, len(health.Checks))}
+		for _, check := range health.Checks {
+			c := healthCheck{Name: check.Name, Status: check.Status, Message: check.Message}
+			if !check.Time.IsZero() {
+				c.Time = &check.Time
+			}
+			response.Checks = append(response.Checks, c)
+		}
+
+		status := http.StatusOK
+		if health.Status != domain.HealthStatusOK {
+			status = http.StatusServiceUnavailable
+			log.Debug().Str("path", r.URL.Path).Interface("checks", response.Checks).Msg("health check failing")
+		}
+
+		writeJSON(w, status, response)
+	}
+}
@@ -0,0 +1,46 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// Server serves the monitoring endpoints of the service.
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func NewServer(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+	}
+}
+
+// Handle registers a handler for a pattern, see http.ServeMux.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start serves in the background.
+func (s *Server) Start() {
+	go func() {
+		err := s.server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Panic().Err(err).Msg("failed to serve http")
+		}
+	}()
+
+	log.Info().Str("address", s.server.Addr).Msg("serving http")
+}
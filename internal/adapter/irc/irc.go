@@ -0,0 +1,371 @@
+package irc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"streamobserver/internal/adapter/relay"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultLiveFormat    = "🔴 {{ .Username }} is live: {{ .Title }} {{ .URL }}"
+	DefaultOfflineFormat = "❌ {{ .Username }} is offline"
+
+	DefaultFloodBurst    = 4
+	DefaultFloodInterval = 2 * time.Second
+
+	dialTimeout   = 30 * time.Second
+	readTimeout   = 5 * time.Minute
+	maxTextLength = 400
+)
+
+// Config holds the settings of the IRC connection, the target of a notification is a channel.
+type Config struct {
+	// Server is the address of the IRC server as host:port.
+	Server string
+	// TLS connects with TLS.
+	TLS bool
+	// Nick, User and RealName identify the bot.
+	Nick     string
+	User     string
+	RealName string
+	// SASLUser and SASLPassword enable SASL PLAIN authentication.
+	SASLUser     string
+	SASLPassword string
+	// NickServPassword identifies with NickServ after connecting.
+	NickServPassword string
+	// Channels are joined on connect, channels used as targets are joined on demand.
+	Channels []string
+	// FloodBurst and FloodInterval limit outgoing lines to a burst, refilled by one line per interval.
+	FloodBurst    int
+	FloodInterval time.Duration
+	// LiveFormat and OfflineFormat are text/templates rendering a domain.StreamInfo as a single line.
+	LiveFormat    string
+	OfflineFormat string
+}
+
+// Sender keeps a long-lived connection to an IRC server, reconnecting automatically. IRC messages can not be
+// edited, updates are only announced when the online state of a stream changes.
+type Sender struct {
+	*relay.Relay
+
+	config Config
+}
+
+var _ port.Notifier = (*Sender)(nil)
+var _ port.StreamEndListener = (*Sender)(nil)
+
+func NewIRCSender(config Config) (*Sender, error) {
+	if config.Server == "" || config.Nick == "" {
+		return nil, errors.New("irc server and nick must be set")
+	}
+	if config.User == "" {
+		config.User = config.Nick
+	}
+	if config.RealName == "" {
+		config.RealName = config.Nick
+	}
+	if config.FloodBurst <= 0 {
+		config.FloodBurst = DefaultFloodBurst
+	}
+	if config.FloodInterval <= 0 {
+		config.FloodInterval = DefaultFloodInterval
+	}
+	if config.LiveFormat == "" {
+		config.LiveFormat = DefaultLiveFormat
+	}
+	if config.OfflineFormat == "" {
+		config.OfflineFormat = DefaultOfflineFormat
+	}
+
+	r, err := relay.New(relay.Config{
+		Name:          "irc",
+		Server:        config.Server,
+		LiveFormat:    config.LiveFormat,
+		OfflineFormat: config.OfflineFormat,
+		Clean:         sanitize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sender{Relay: r, config: config}
+
+	go s.Run(s.session)
+
+	return s, nil
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindIRC
+}
+
+// sanitize collapses a text to a single line and truncates it to fit into an IRC message.
+func sanitize(text string) string {
+	text = relay.Collapse(text)
+	if len(text) <= maxTextLength {
+		return text
+	}
+
+	cut := maxTextLength
+	for cut > 0 && !isRuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// session runs a single connection until it fails. A message that could not be delivered is kept in pending.
+func (s *Sender) session(queue <-chan relay.Message, pending **relay.Message) error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go read(conn, lines, readErr, done)
+
+	w := &writer{conn: conn}
+	err = s.register(w)
+	if err != nil {
+		return err
+	}
+
+	tokens := s.config.FloodBurst
+	refill := time.NewTicker(s.config.FloodInterval)
+	defer refill.Stop()
+
+	ready := false
+	// configured channels are joined on welcome, before the queue is processed
+	joined := make(map[string]bool)
+	for _, channel := range s.config.Channels {
+		joined[strings.ToLower(channel)] = true
+	}
+
+	for {
+		var next <-chan relay.Message
+		if ready && tokens > 0 && *pending == nil {
+			next = queue
+		}
+
+		select {
+		case err = <-readErr:
+			return err
+		case line := <-lines:
+			ready, err = s.handle(w, line, ready)
+			if err != nil {
+				return err
+			}
+		case <-refill.C:
+			tokens = min(tokens+1, s.config.FloodBurst)
+		case m := <-next:
+			*pending = &m
+		}
+
+		if !ready || *pending == nil || tokens == 0 {
+			continue
+		}
+
+		m := **pending
+		channel := strings.ToLower(m.Target)
+		if !joined[channel] {
+			err = w.send("JOIN " + m.Target)
+			if err != nil {
+				return err
+			}
+			joined[channel] = true
+			tokens--
+			continue
+		}
+
+		err = w.send("PRIVMSG " + m.Target + " :" + m.Text)
+		if err != nil {
+			return err
+		}
+		*pending = nil
+		tokens--
+	}
+}
+
+func (s *Sender) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if s.config.TLS {
+		host, _, err := net.SplitHostPort(s.config.Server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid irc server address: %w", err)
+		}
+		conn, err := tls.DialWithDialer(dialer, "tcp", s.config.Server,
+			&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to irc server: %w", err)
+		}
+		return conn, nil
+	}
+
+	conn, err := dialer.Dial("tcp", s.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to irc server: %w", err)
+	}
+	return conn, nil
+}
+
+// register starts the connection registration, requesting SASL if configured.
+func (s *Sender) register(w *writer) error {
+	if s.config.SASLUser != "" {
+		err := w.send("CAP REQ :sasl")
+		if err != nil {
+			return err
+		}
+	}
+
+	w.nick = s.config.Nick
+	err := w.send("NICK " + w.nick)
+	if err != nil {
+		return err
+	}
+
+	return w.send("USER " + s.config.User + " 0 * :" + s.config.RealName)
+}
+
+// handle reacts to a line from the server and reports whether registration completed.
+func (s *Sender) handle(w *writer, line string, ready bool) (bool, error) {
+	prefix, command, params := parse(line)
+	log.Debug().Str("prefix", prefix).Str("command", command).Strs("params", params).Msg("irc line received")
+
+	switch command {
+	case "PING":
+		return ready, w.send("PONG :" + last(params))
+	case "CAP":
+		if len(params) > 1 && params[1] == "ACK" && strings.Contains(last(params), "sasl") {
+			return ready, w.send("AUTHENTICATE PLAIN")
+		}
+		if len(params) > 1 && params[1] == "NAK" {
+			log.Warn().Msg("irc server does not support sasl")
+			return ready, w.send("CAP END")
+		}
+	case "AUTHENTICATE":
+		if last(params) == "+" {
+			auth := "\x00" + s.config.SASLUser + "\x00" + s.config.SASLPassword
+			return ready, w.send("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte(auth)))
+		}
+	case "903":
+		return ready, w.send("CAP END")
+	case "904", "905":
+		return ready, errors.New("irc sasl authentication failed")
+	case "433":
+		w.nick += "_"
+		return ready, w.send("NICK " + w.nick)
+	case "001":
+		log.Info().Str("server", s.config.Server).Msg("connected to irc")
+		return true, s.welcome(w)
+	case "ERROR":
+		return ready, fmt.Errorf("irc server closed the connection: %s", last(params))
+	}
+
+	return ready, nil
+}
+
+// welcome identifies with NickServ and joins the configured channels.
+func (s *Sender) welcome(w *writer) error {
+	if s.config.NickServPassword != "" {
+		err := w.send("PRIVMSG NickServ :IDENTIFY " + s.config.NickServPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, channel := range s.config.Channels {
+		err := w.send("JOIN " + channel)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type writer struct {
+	conn net.Conn
+	// nick of the connection, differs from the configured nick if that was taken
+	nick string
+}
+
+func (w *writer) send(line string) error {
+	_, err := w.conn.Write([]byte(line + "\r\n"))
+	if err != nil {
+		return fmt.Errorf("error writing to irc server: %w", err)
+	}
+	return nil
+}
+
+// read forwards lines from the server until the connection fails or the session is done.
+func read(conn net.Conn, lines chan<- string, errCh chan<- error, done <-chan struct{}) {
+	scanner := bufio.NewScanner(conn)
+	for {
+		err := conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if err != nil {
+			errCh <- fmt.Errorf("error setting irc read deadline: %w", err)
+			return
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		select {
+		case lines <- scanner.Text():
+		case <-done:
+			return
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = errors.New("irc connection closed")
+	}
+	errCh <- err
+}
+
+// parse splits a raw IRC line into prefix, command and parameters.
+func parse(line string) (string, string, []string) {
+	var prefix string
+	if strings.HasPrefix(line, ":") {
+		prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	line, trailing, hasTrailing := strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return prefix, "", nil
+	}
+
+	params := fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+
+	return prefix, strings.ToUpper(fields[0]), params
+}
+
+func last(params []string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	return params[len(params)-1]
+}
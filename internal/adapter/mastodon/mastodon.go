@@ -0,0 +1,279 @@
+package mastodon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	statusesPath = "/api/v1/statuses"
+	mediaPath    = "/api/v2/media"
+	mimeType     = "application/json"
+	maxImageSize = 8 << 20
+)
+
+// Account holds the settings of a Mastodon account, addressed by name as the notification target.
+type Account struct {
+	// Server is the base URL of the instance.
+	Server string
+	// Token is an access token with the write:statuses and write:media scopes.
+	Token string
+	// Visibility of the posts, one of public, unlisted, private or direct.
+	Visibility string
+	// Language is the ISO 639 code of the posts.
+	Language string
+	// AttachThumbnail uploads the thumbnail as media instead of relying on the link card.
+	AttachThumbnail bool
+}
+
+type Sender struct {
+	accounts map[string]Account
+	client   *http.Client
+}
+
+var _ port.Notifier = (*Sender)(nil)
+var _ port.MessageDeleter = (*Sender)(nil)
+var _ port.MessageReplier = (*Sender)(nil)
+
+type statusRequest struct {
+	Status      string   `json:"status"`
+	Visibility  string   `json:"visibility,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	MediaIDs    []string `json:"media_ids,omitempty"`
+	InReplyToID string   `json:"in_reply_to_id,omitempty"`
+}
+
+type idResponse struct {
+	ID string `json:"id"`
+}
+
+func NewMastodonSender(accounts map[string]Account) (*Sender, error) {
+	s := &Sender{
+		accounts: make(map[string]Account),
+		client:   &http.Client{},
+	}
+
+	for name, account := range accounts {
+		if account.Server == "" || account.Token == "" {
+			return nil, fmt.Errorf("server and token must be set for mastodon account %s", name)
+		}
+
+		account.Server = strings.TrimSuffix(account.Server, "/")
+		s.accounts[strings.ToLower(name)] = account
+	}
+
+	return s, nil
+}
+
+// SendStreamInfo posts a go-live status for a domain.StreamInfo and returns the status ID.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	account, err := s.account(target)
+	if err != nil {
+		return "", err
+	}
+
+	var viewerInfo string
+	if stream.ViewerCount > -1 {
+		viewerInfo = fmt.Sprintf(" for %d viewers", stream.ViewerCount)
+	}
+
+	status := statusRequest{
+		Status:     fmt.Sprintf("🔴 %s is streaming %s%s\n\n%s", stream.Username, stream.Title, viewerInfo, stream.URL),
+		Visibility: account.Visibility,
+		Language:   account.Language,
+	}
+
+	if account.AttachThumbnail && stream.ThumbnailURL != "" {
+		mediaID, err := s.uploadThumbnail(ctx, account, stream)
+		if err != nil {
+			log.Warn().Err(err).Str("stream", stream.Username).Msg("failed to upload thumbnail, posting without")
+		} else {
+			status.MediaIDs = []string{mediaID}
+		}
+	}
+
+	var response idResponse
+	err = s.request(ctx, account, http.MethodPost, statusesPath, status, &response)
+	if err != nil {
+		return "", fmt.Errorf("error posting mastodon status: %w", err)
+	}
+
+	return response.ID, nil
+}
+
+// UpdateStreamInfo is a no-op, the go-live status is not edited. Use the delete or repost offline policy to
+// act on the status when a stream ends.
+func (s *Sender) UpdateStreamInfo(_ context.Context, target string, _ string, _ domain.StreamInfo) error {
+	_, err := s.account(target)
+	return err
+}
+
+// DeleteStreamInfo deletes the go-live status.
+func (s *Sender) DeleteStreamInfo(ctx context.Context, target string, messageID string) error {
+	account, err := s.account(target)
+	if err != nil {
+		return err
+	}
+
+	err = s.request(ctx, account, http.MethodDelete, statusesPath+"/"+messageID, nil, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting mastodon status: %w", err)
+	}
+
+	return nil
+}
+
+// ReplyStreamInfo posts a "stream ended" status in reply to the go-live status and returns the ID of the reply.
+func (s *Sender) ReplyStreamInfo(ctx context.Context,
+	target string,
+	messageID string,
+	stream domain.StreamInfo) (string, error) {
+	account, err := s.account(target)
+	if err != nil {
+		return "", err
+	}
+
+	var response idResponse
+	err = s.request(ctx, account, http.MethodPost, statusesPath, statusRequest{
+		Status:      fmt.Sprintf("❌ %s was streaming %s", stream.Username, stream.Title),
+		Visibility:  account.Visibility,
+		Language:    account.Language,
+		InReplyToID: messageID,
+	}, &response)
+	if err != nil {
+		return "", fmt.Errorf("error replying to mastodon status: %w", err)
+	}
+
+	return response.ID, nil
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindMastodon
+}
+
+func (s *Sender) account(target string) (Account, error) {
+	account, ok := s.accounts[strings.ToLower(target)]
+	if !ok {
+		return Account{}, fmt.Errorf("unknown mastodon account %q", target)
+	}
+	return account, nil
+}
+
+// uploadThumbnail fetches the thumbnail of a stream and uploads it as media attachment.
+func (s *Sender) uploadThumbnail(ctx context.Context, account Account, stream domain.StreamInfo) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stream.ThumbnailURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error building thumbnail request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching thumbnail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response fetching thumbnail: %d", resp.StatusCode)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize))
+	if err != nil {
+		return "", fmt.Errorf("error reading thumbnail: %w", err)
+	}
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	err = w.WriteField("description", stream.Username+" stream thumbnail")
+	if err != nil {
+		return "", fmt.Errorf("error writing media form: %w", err)
+	}
+	file, err := w.CreateFormFile("file", "thumbnail")
+	if err != nil {
+		return "", fmt.Errorf("error writing media form: %w", err)
+	}
+	_, err = file.Write(image)
+	if err != nil {
+		return "", fmt.Errorf("error writing media form: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return "", fmt.Errorf("error writing media form: %w", err)
+	}
+
+	var response idResponse
+	err = s.do(ctx, account, http.MethodPost, mediaPath, w.FormDataContentType(), body, &response)
+	if err != nil {
+		return "", fmt.Errorf("error uploading mastodon media: %w", err)
+	}
+
+	return response.ID, nil
+}
+
+// request sends an optional JSON body to the instance and decodes the response into result if set.
+func (s *Sender) request(ctx context.Context, account Account, method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding mastodon request: %w", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	return s.do(ctx, account, method, path, mimeType, reader, result)
+}
+
+func (s *Sender) do(ctx context.Context,
+	account Account,
+	method string,
+	path string,
+	contentType string,
+	body io.Reader,
+	result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, account.Server+path, body)
+	if err != nil {
+		return fmt.Errorf("error building request for mastodon: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", mimeType)
+	req.Header.Set("Authorization", "Bearer "+account.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request to mastodon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unexpected response from mastodon: %d", resp.StatusCode)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("error decoding response from mastodon: %w", err)
+	}
+
+	if r, ok := result.(*idResponse); ok && r.ID == "" {
+		return errors.New("mastodon returned no id")
+	}
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultClientID        = "streamobserver"
+	DefaultStatusTopic     = "streamobserver/status"
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	statusOnline  = "online"
+	statusOffline = "offline"
+
+	eventLive    = "live"
+	eventOffline = "offline"
+
+	qos            = 1
+	publishTimeout = 10 * time.Second
+	maxReconnect   = 2 * time.Minute
+)
+
+// Config holds the broker settings, the target of a notification is the base topic of the stream topics.
+type Config struct {
+	// Broker is the URL of the broker, e.g. tcp://host:1883 or ssl://host:8883.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// StatusTopic receives "online" on connect and "offline" as last will.
+	StatusTopic string
+	// Discovery publishes Home Assistant MQTT discovery configs below DiscoveryPrefix.
+	Discovery       bool
+	DiscoveryPrefix string
+}
+
+// Sender publishes the state of streams as retained JSON to <base>/<kind>/<id>/state and go-live and offline
+// events to <base>/<kind>/<id>/event.
+type Sender struct {
+	config Config
+	client paho.Client
+
+	mu         sync.Mutex
+	discovered map[string]bool
+}
+
+var _ port.Notifier = (*Sender)(nil)
+
+type statePayload struct {
+	Kind         string `json:"kind"`
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	Title        string `json:"title"`
+	Category     string `json:"category"`
+	URL          string `json:"url"`
+	ViewerCount  int    `json:"viewer_count"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Online       bool   `json:"online"`
+	Updated      int64  `json:"updated"`
+	// the session fields describe the current or last session of the stream, zero if untracked
+	StartedAt      int64 `json:"started_at,omitempty"`
+	Duration       int64 `json:"duration,omitempty"`
+	PeakViewers    int   `json:"peak_viewers"`
+	AverageViewers int   `json:"average_viewers"`
+}
+
+type eventPayload struct {
+	Event string       `json:"event"`
+	State statePayload `json:"state"`
+}
+
+type discoveryDevice struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+}
+
+type discoveryPayload struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	StateTopic          string          `json:"state_topic"`
+	ValueTemplate       string          `json:"value_template"`
+	JSONAttributesTopic string          `json:"json_attributes_topic"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	PayloadAvailable    string          `json:"payload_available"`
+	PayloadNotAvailable string          `json:"payload_not_available"`
+	Icon                string          `json:"icon"`
+	Device              discoveryDevice `json:"device"`
+}
+
+func NewMQTTSender(config Config) (*Sender, error) {
+	if config.Broker == "" {
+		return nil, errors.New("mqtt broker is not set")
+	}
+	if config.ClientID == "" {
+		config.ClientID = DefaultClientID
+	}
+	if config.StatusTopic == "" {
+		config.StatusTopic = DefaultStatusTopic
+	}
+	if config.DiscoveryPrefix == "" {
+		config.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+
+	s := &Sender{
+		config:     config,
+		discovered: make(map[string]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetWill(config.StatusTopic, statusOffline, qos, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(maxReconnect).
+		SetOnConnectHandler(s.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Str("broker", config.Broker).Msg("mqtt connection lost, reconnecting")
+		})
+
+	s.client = paho.NewClient(opts)
+	// with connect retry enabled the token only completes once connected, publishing is queued until then
+	s.client.Connect()
+
+	return s, nil
+}
+
+// onConnect announces availability and republishes the discovery configs, the broker may have lost them.
+func (s *Sender) onConnect(c paho.Client) {
+	log.Info().Str("broker", s.config.Broker).Msg("connected to mqtt broker")
+
+	c.Publish(s.config.StatusTopic, qos, true, statusOnline)
+
+	s.mu.Lock()
+	clear(s.discovered)
+	s.mu.Unlock()
+}
+
+// SendStreamInfo publishes the state of a stream that went live together with a live event, the handle is the
+// state topic.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	event := eventOffline
+	if stream.IsOnline {
+		event = eventLive
+	}
+
+	return s.publishStream(ctx, target, stream, event)
+}
+
+// UpdateStreamInfo publishes the current state of a stream, adding an offline event when the stream ended.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, _ string, stream domain.StreamInfo) error {
+	var event string
+	if !stream.IsOnline {
+		event = eventOffline
+	}
+
+	_, err := s.publishStream(ctx, target, stream, event)
+	return err
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindMQTT
+}
+
+func (s *Sender) publishStream(ctx context.Context, base string, stream domain.StreamInfo, event string) (string, error) {
+	if stream.Query == nil {
+		return "", errors.New("stream has no query")
+	}
+
+	streamTopic := strings.TrimSuffix(base, "/") + "/" + string(stream.Query.Kind) + "/" + topicLevel(stream.Query.UserID)
+	stateTopic := streamTopic + "/state"
+
+	state := statePayload{
+		Kind:         string(stream.Query.Kind),
+		ID:           stream.Query.UserID,
+		Username:     stream.Username,
+		Title:        stream.Title,
+		Category:     stream.Category,
+		URL:          stream.URL,
+		ViewerCount:  stream.ViewerCount,
+		ThumbnailURL: stream.ThumbnailURL,
+		Online:       stream.IsOnline,
+		Updated:      time.Now().Unix(),
+	}
+	if stream.Session != nil {
+		state.StartedAt = stream.Session.StartedAt.Unix()
+		state.Duration = int64(stream.Session.Duration().Seconds())
+		state.PeakViewers = stream.Session.PeakViewers
+		state.AverageViewers = stream.Session.AverageViewers()
+	}
+
+	err := s.discover(ctx, stateTopic, stream)
+	if err != nil {
+		log.Warn().Err(err).Str("topic", stateTopic).Msg("failed to publish home assistant discovery")
+	}
+
+	err = s.publish(ctx, stateTopic, true, state)
+	if err != nil {
+		return "", fmt.Errorf("error publishing mqtt state: %w", err)
+	}
+
+	if event != "" {
+		err = s.publish(ctx, streamTopic+"/event", false, eventPayload{Event: event, State: state})
+		if err != nil {
+			return "", fmt.Errorf("error publishing mqtt event: %w", err)
+		}
+	}
+
+	return stateTopic, nil
+}
+
+// discover publishes a retained Home Assistant binary_sensor config for a state topic once per connection.
+func (s *Sender) discover(ctx context.Context, stateTopic string, stream domain.StreamInfo) error {
+	if !s.config.Discovery {
+		return nil
+	}
+
+	s.mu.Lock()
+	done := s.discovered[stateTopic]
+	s.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	uniqueID := "streamobserver_" + objectID(stateTopic)
+	err := s.publish(ctx, s.config.DiscoveryPrefix+"/binary_sensor/"+uniqueID+"/config", true, discoveryPayload{
+		Name:                stream.Username + " live",
+		UniqueID:            uniqueID,
+		StateTopic:          stateTopic,
+		ValueTemplate:       "{{ 'ON' if value_json.online else 'OFF' }}",
+		JSONAttributesTopic: stateTopic,
+		AvailabilityTopic:   s.config.StatusTopic,
+		PayloadAvailable:    statusOnline,
+		PayloadNotAvailable: statusOffline,
+		Icon:                "mdi:broadcast",
+		Device: discoveryDevice{
+			Identifiers: []string{s.config.ClientID},
+			Name:        "Streamobserver",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.discovered[stateTopic] = true
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Sender) publish(ctx context.Context, topic string, retained bool, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding mqtt payload: %w", err)
+	}
+
+	token := s.client.Publish(topic, qos, retained, b)
+
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(publishTimeout):
+		return fmt.Errorf("timeout publishing to %s", topic)
+	}
+}
+
+// topicLevel makes a stream ID usable as a single topic level.
+func topicLevel(id string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(id)
+}
+
+// objectID derives a Home Assistant object ID, which may only contain alphanumerics, underscores and hyphens.
+func objectID(topic string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSuffix(topic, "/state"))
+}
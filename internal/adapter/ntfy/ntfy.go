@@ -0,0 +1,155 @@
+package ntfy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultServer = "https://ntfy.sh"
+
+	maxPriority = 5
+
+	liveTag    = "red_circle"
+	offlineTag = "x"
+	mimeType   = "application/json"
+)
+
+// Config holds the settings of a ntfy server, the target of a notification is the topic.
+type Config struct {
+	// Server is the base URL of the ntfy server.
+	Server string
+	// Token is an optional access token for protected topics.
+	Token string
+	// Priority is the message priority from 1 (min) to 5 (max), the server default is used if 0.
+	Priority int
+	// Tags are additional tags or emoji shortcodes added to every message.
+	Tags []string
+	// OfflineNotice publishes a separate message when a stream ends, ntfy messages can not be edited.
+	OfflineNotice bool
+}
+
+type Sender struct {
+	config Config
+	client *http.Client
+}
+
+var _ port.Notifier = (*Sender)(nil)
+
+type publishRequest struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Click    string   `json:"click,omitempty"`
+	Attach   string   `json:"attach,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+}
+
+type publishResponse struct {
+	ID string `json:"id"`
+}
+
+func NewNtfySender(config Config) (*Sender, error) {
+	if config.Server == "" {
+		config.Server = DefaultServer
+	}
+	if config.Priority < 0 || config.Priority > maxPriority {
+		return nil, fmt.Errorf("invalid ntfy priority %d, expected 1-%d", config.Priority, maxPriority)
+	}
+	config.Server = strings.TrimSuffix(config.Server, "/")
+
+	return &Sender{config: config, client: &http.Client{}}, nil
+}
+
+// SendStreamInfo publishes a go-live message for a domain.StreamInfo to a topic.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	var viewerInfo string
+	if stream.ViewerCount > -1 {
+		viewerInfo = fmt.Sprintf(" for %d viewers", stream.ViewerCount)
+	}
+
+	return s.publish(ctx, publishRequest{
+		Topic:    target,
+		Title:    stream.Username + " is live",
+		Message:  fmt.Sprintf("%s is streaming %s%s", stream.Username, stream.Title, viewerInfo),
+		Click:    stream.URL,
+		Attach:   stream.ThumbnailURL,
+		Tags:     append([]string{liveTag}, s.config.Tags...),
+		Priority: s.config.Priority,
+	})
+}
+
+// UpdateStreamInfo publishes an offline notice if enabled, updates of live streams are skipped since ntfy
+// messages can not be edited.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	if stream.IsOnline || !s.config.OfflineNotice {
+		log.Debug().Str("topic", target).Str("message", messageID).Msg("ntfy does not support edits, skipping update")
+		return nil
+	}
+
+	_, err := s.publish(ctx, publishRequest{
+		Topic:    target,
+		Title:    stream.Username + " is offline",
+		Message:  fmt.Sprintf("%s was streaming %s", stream.Username, stream.Title),
+		Click:    stream.URL,
+		Tags:     append([]string{offlineTag}, s.config.Tags...),
+		Priority: s.config.Priority,
+	})
+
+	return err
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindNtfy
+}
+
+func (s *Sender) publish(ctx context.Context, message publishRequest) (string, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("error encoding ntfy message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Server, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error building request for ntfy: %w", err)
+	}
+
+	req.Header.Set("Content-Type", mimeType)
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request to ntfy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from ntfy: %d", resp.StatusCode)
+	}
+
+	var response publishResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", fmt.Errorf("error decoding response from ntfy: %w", err)
+	}
+
+	if response.ID == "" {
+		return "", errors.New("ntfy returned no message id")
+	}
+
+	log.Debug().Str("topic", message.Topic).Str("id", response.ID).Msg("published ntfy message")
+
+	return response.ID, nil
+}
@@ -0,0 +1,177 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "streamobserver"
+
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+)
+
+// Metrics collects the metrics of the poller and the notifiers in a dedicated registry.
+type Metrics struct {
+	registry *prom.Registry
+
+	pollDuration  *prom.HistogramVec
+	polls         *prom.CounterVec
+	httpResponses *prom.CounterVec
+	tokenRefresh  *prom.CounterVec
+	streams       prom.Gauge
+	observers     prom.Gauge
+	live          prom.Gauge
+	viewers       *prom.GaugeVec
+	notifications *prom.CounterVec
+}
+
+var _ port.Metrics = (*Metrics)(nil)
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prom.NewRegistry(),
+		pollDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "poll_duration_seconds",
+			Help:      "Duration of polling the streams of a provider.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20},
+		}, []string{"provider"}),
+		polls: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "polls_total",
+			Help:      "Polls of the streams of a provider by outcome.",
+		}, []string{"provider", "outcome"}),
+		httpResponses: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "provider_http_responses_total",
+			Help:      "HTTP responses of the streaming services by status code.",
+		}, []string{"provider", "code"}),
+		tokenRefresh: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refreshes_total",
+			Help:      "Refreshes of the access token of a streaming service by outcome.",
+		}, []string{"provider", "outcome"}),
+		streams: prom.NewGauge(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "observed_streams",
+			Help:      "Number of observed streams.",
+		}),
+		observers: prom.NewGauge(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "observers",
+			Help:      "Number of notification targets observing a stream.",
+		}),
+		live: prom.NewGauge(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "live_streams",
+			Help:      "Number of streams currently live.",
+		}),
+		viewers: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stream_viewers",
+			Help:      "Viewers of a live stream.",
+		}, []string{"kind", "id"}),
+		notifications: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_total",
+			Help:      "Notifier operations by outcome, failures by error class.",
+		}, []string{"notifier", "operation", "outcome", "class"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.pollDuration, m.polls, m.httpResponses, m.tokenRefresh,
+		m.streams, m.observers, m.live, m.viewers, m.notifications,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObservePoll(kind domain.StreamKind, duration time.Duration, err error) {
+	m.pollDuration.WithLabelValues(string(kind)).Observe(duration.Seconds())
+	m.polls.WithLabelValues(string(kind), outcome(err)).Inc()
+}
+
+func (m *Metrics) ObserveHTTPResponse(kind domain.StreamKind, status int) {
+	m.httpResponses.WithLabelValues(string(kind), strconv.Itoa(status)).Inc()
+}
+
+func (m *Metrics) ObserveTokenRefresh(kind domain.StreamKind, err error) {
+	m.tokenRefresh.WithLabelValues(string(kind), outcome(err)).Inc()
+}
+
+func (m *Metrics) SetObserved(streams int, observers int) {
+	m.streams.Set(float64(streams))
+	m.observers.Set(float64(observers))
+}
+
+// ObserveStreams sets the live streams and the viewers of every live stream, offline streams are removed.
+func (m *Metrics) ObserveStreams(infos []domain.StreamInfo) {
+	live := 0
+	for _, info := range infos {
+		if info.Query == nil {
+			continue
+		}
+
+		if !info.IsOnline {
+			m.viewers.DeleteLabelValues(string(info.Query.Kind), info.Query.UserID)
+			continue
+		}
+
+		live++
+		if info.ViewerCount >= 0 {
+			m.viewers.WithLabelValues(string(info.Query.Kind), info.Query.UserID).Set(float64(info.ViewerCount))
+		}
+	}
+	m.live.Set(float64(live))
+}
+
+func (m *Metrics) ObserveNotification(kind domain.NotifierKind, operation string, err error) {
+	m.notifications.WithLabelValues(string(kind), operation, outcome(err), errorClass(err)).Inc()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return outcomeError
+	}
+	return outcomeSuccess
+}
+
+// errorClass groups errors for the class label, preferring the class reported by the error itself.
+func errorClass(err error) string {
+	var classified port.ClassifiedError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &classified):
+		return classified.ErrorClass()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
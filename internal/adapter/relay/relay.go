@@ -0,0 +1,173 @@
+// Package relay holds the connection handling shared by notifiers keeping a long-lived connection to a chat server
+// which can not edit sent messages, such as IRC and XMPP.
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	queueSize     = 100
+	minBackoff    = 5 * time.Second
+	maxBackoff    = 5 * time.Minute
+	stableSession = time.Minute
+)
+
+// Message is a rendered line queued for a target.
+type Message struct {
+	Target string
+	Text   string
+}
+
+// Session runs a single connection until it fails, delivering messages from the queue. A message that could not be
+// delivered is kept in pending and handed to the next session.
+type Session func(queue <-chan Message, pending **Message) error
+
+// Config holds the settings shared by the relayed notifiers.
+type Config struct {
+	// Name identifies the protocol in errors and logs.
+	Name string
+	// Server is the address logged when the connection is lost.
+	Server string
+	// LiveFormat and OfflineFormat are text/templates rendering a domain.StreamInfo as a single line.
+	LiveFormat    string
+	OfflineFormat string
+	// Clean optionally post-processes a rendered line, lines are collapsed to a single line otherwise.
+	Clean func(string) string
+}
+
+// Relay queues rendered lines for a connection and tracks the online state per message handle, since messages
+// can not be edited updates are only announced when the online state of a stream changes.
+type Relay struct {
+	config  Config
+	live    *template.Template
+	offline *template.Template
+
+	queue  chan Message
+	lastID atomic.Int64
+
+	mu     sync.Mutex
+	online map[string]bool
+}
+
+func New(config Config) (*Relay, error) {
+	if config.Clean == nil {
+		config.Clean = Collapse
+	}
+
+	live, err := template.New("live").Parse(config.LiveFormat)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s live format: %w", config.Name, err)
+	}
+	offline, err := template.New("offline").Parse(config.OfflineFormat)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s offline format: %w", config.Name, err)
+	}
+
+	return &Relay{
+		config:  config,
+		live:    live,
+		offline: offline,
+		queue:   make(chan Message, queueSize),
+		online:  make(map[string]bool),
+	}, nil
+}
+
+// SendStreamInfo queues a go-live line for a target and returns a handle tracking the online state.
+func (r *Relay) SendStreamInfo(_ context.Context, target string, stream domain.StreamInfo) (string, error) {
+	err := r.enqueue(target, stream)
+	if err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatInt(r.lastID.Add(1), 10)
+
+	r.mu.Lock()
+	r.online[id] = stream.IsOnline
+	r.mu.Unlock()
+
+	return id, nil
+}
+
+// UpdateStreamInfo queues a line only if the online state differs from the last announcement.
+func (r *Relay) UpdateStreamInfo(_ context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	r.mu.Lock()
+	online, ok := r.online[messageID]
+	if ok && online == stream.IsOnline {
+		r.mu.Unlock()
+		return nil
+	}
+	if stream.IsOnline {
+		r.online[messageID] = true
+	} else {
+		delete(r.online, messageID)
+	}
+	r.mu.Unlock()
+
+	return r.enqueue(target, stream)
+}
+
+// StreamEnded stops tracking the online state of a message handle.
+func (r *Relay) StreamEnded(_ context.Context, _ string, messageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.online, messageID)
+	return nil
+}
+
+// Run keeps the connection alive by running sessions, reconnecting with exponential backoff.
+func (r *Relay) Run(session Session) {
+	backoff := minBackoff
+	var pending *Message
+
+	for {
+		start := time.Now()
+		err := session(r.queue, &pending)
+		if time.Since(start) > stableSession {
+			backoff = minBackoff
+		}
+
+		log.Warn().Err(err).Str("server", r.config.Server).Dur("backoff", backoff).
+			Msgf("%s connection lost, reconnecting", r.config.Name)
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (r *Relay) enqueue(target string, stream domain.StreamInfo) error {
+	tmpl := r.live
+	if !stream.IsOnline {
+		tmpl = r.offline
+	}
+
+	text := new(strings.Builder)
+	err := tmpl.Execute(text, stream)
+	if err != nil {
+		return fmt.Errorf("error rendering %s message: %w", r.config.Name, err)
+	}
+
+	select {
+	case r.queue <- Message{Target: target, Text: r.config.Clean(text.String())}:
+		return nil
+	default:
+		return errors.New(r.config.Name + " queue is full")
+	}
+}
+
+// Collapse joins the fields of a text into a single line.
+func Collapse(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -20,7 +20,10 @@ const (
 	channelSuffix  = ".html"
 )
 
-type StreamInfoProvider struct{}
+type StreamInfoProvider struct {
+	// Metrics optionally records the HTTP responses of the restreamer instances.
+	Metrics port.Metrics
+}
 
 var _ = (*port.StreamInfoProvider)(nil)
 
@@ -30,7 +33,9 @@ type restreamerResponse struct {
 	ThumbnailURL string `json:"thumbnail_url"`
 }
 
-func checkOnline(ctx context.Context, stream domain.StreamQuery, client *http.Client) (bool, error) {
+func (s *StreamInfoProvider) checkOnline(ctx context.Context,
+	stream domain.StreamQuery,
+	client *http.Client) (bool, error) {
 	url := stream.BaseURL + internalPath + stream.UserID + playlistSuffix
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -41,13 +46,16 @@ func checkOnline(ctx context.Context, stream domain.StreamQuery, client *http.Cl
 	if err != nil {
 		return false, fmt.Errorf("get stream online request failed: %w", err)
 	}
+	s.observeResponse(resp.StatusCode)
 
 	defer resp.Body.Close()
 
 	return resp.StatusCode == http.StatusOK, nil
 }
 
-func fetchInfo(ctx context.Context, stream domain.StreamQuery, client *http.Client) (restreamerResponse, error) {
+func (s *StreamInfoProvider) fetchInfo(ctx context.Context,
+	stream domain.StreamQuery,
+	client *http.Client) (restreamerResponse, error) {
 	url := stream.BaseURL + channelPath + stream.UserID + embedSuffix
 	log.Debug().Str("URL", url).Msg("getting restreamer stream config from URL")
 
@@ -60,6 +68,7 @@ func fetchInfo(ctx context.Context, stream domain.StreamQuery, client *http.Clie
 	if err != nil {
 		return restreamerResponse{}, fmt.Errorf("get stream info request failed: %w", err)
 	}
+	s.observeResponse(resp.StatusCode)
 
 	defer resp.Body.Close()
 
@@ -86,23 +95,21 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 
 	streamInfos := make([]domain.StreamInfo, 0)
 	infoCh := make(chan domain.StreamInfo, len(streams))
-	errCh := make(chan error, len(streams))
+	errCh := make(chan streamError, len(streams))
 
 	client := &http.Client{}
 
 	for _, stream := range streams {
-		go fetch(ctx, stream, client, infoCh, errCh, wg2)
+		go s.fetch(ctx, stream, client, infoCh, errCh, wg2)
 	}
 
 	wg2.Wait()
 	close(infoCh)
 	close(errCh)
 
+	failed := make(domain.StreamErrors)
 	for err := range errCh {
-		if err != nil {
-			errorCh <- fmt.Errorf("error getting restreamer stream info: %w", err)
-			return
-		}
+		failed[*err.query] = err.err
 	}
 
 	for info := range infoCh {
@@ -110,19 +117,28 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 	}
 
 	infos <- streamInfos
+	if len(failed) > 0 {
+		errorCh <- failed
+	}
+}
+
+// streamError is the failure to fetch a single stream.
+type streamError struct {
+	query *domain.StreamQuery
+	err   error
 }
 
-func fetch(ctx context.Context,
+func (s *StreamInfoProvider) fetch(ctx context.Context,
 	query *domain.StreamQuery,
 	client *http.Client,
 	stream chan<- domain.StreamInfo,
-	errs chan<- error,
+	errs chan<- streamError,
 	wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	online, err := checkOnline(ctx, *query, client)
+	online, err := s.checkOnline(ctx, *query, client)
 	if err != nil {
-		errs <- fmt.Errorf("error checking if stream %s is online: %w", query.UserID, err)
+		errs <- streamError{query: query, err: fmt.Errorf("error checking if stream is online: %w", err)}
 		return
 	}
 
@@ -134,9 +150,9 @@ func fetch(ctx context.Context,
 		return
 	}
 
-	info, err := fetchInfo(ctx, *query, client)
+	info, err := s.fetchInfo(ctx, *query, client)
 	if err != nil {
-		errs <- fmt.Errorf("error fetching stream %s info: %w", query.UserID, err)
+		errs <- streamError{query: query, err: fmt.Errorf("error fetching stream info: %w", err)}
 		return
 	}
 
@@ -162,3 +178,10 @@ func fetch(ctx context.Context,
 func (s *StreamInfoProvider) Kind() domain.StreamKind {
 	return domain.StreamKindRestreamer
 }
+
+// observeResponse records the status code of a response if metrics are set.
+func (s *StreamInfoProvider) observeResponse(status int) {
+	if s.Metrics != nil {
+		s.Metrics.ObserveHTTPResponse(s.Kind(), status)
+	}
+}
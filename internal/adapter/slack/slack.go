@@ -0,0 +1,246 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	slackAPIURL     = "https://slack.com/api/"
+	postMessagePath = "chat.postMessage"
+	updatePath      = "chat.update"
+	slackMimeType   = "application/json; charset=utf-8"
+
+	liveText    = "🔴 LIVE"
+	offlineText = "❌ OFFLINE"
+
+	rateLimitedError = "ratelimited"
+
+	DefaultMaxRetries = 3
+	defaultRetryAfter = time.Second
+)
+
+// Config holds the Slack app settings, the target of a notification is a channel ID.
+type Config struct {
+	// Token is the bot token of the Slack app, requiring the chat:write scope.
+	Token string
+	// MaxRetries is the number of attempts after a rate limited request.
+	MaxRetries int
+}
+
+type Sender struct {
+	config Config
+	client *http.Client
+}
+
+var _ port.Notifier = (*Sender)(nil)
+
+type block map[string]any
+
+type messageRequest struct {
+	Channel     string  `json:"channel"`
+	TS          string  `json:"ts,omitempty"`
+	Text        string  `json:"text"`
+	Blocks      []block `json:"blocks"`
+	UnfurlLinks bool    `json:"unfurl_links"`
+	UnfurlMedia bool    `json:"unfurl_media"`
+}
+
+type messageResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+func NewSlackSender(config Config) (*Sender, error) {
+	if config.Token == "" {
+		return nil, errors.New("slack token is not set")
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+
+	return &Sender{config: config, client: &http.Client{}}, nil
+}
+
+// SendStreamInfo posts a Block Kit message for a domain.StreamInfo to a channel and returns its timestamp.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	text, blocks := buildMessage(stream)
+
+	response, err := s.call(ctx, postMessagePath, messageRequest{
+		Channel: target,
+		Text:    text,
+		Blocks:  blocks,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error posting slack message: %w", err)
+	}
+
+	return response.TS, nil
+}
+
+// UpdateStreamInfo replaces a previously posted message with the current domain.StreamInfo.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	text, blocks := buildMessage(stream)
+
+	_, err := s.call(ctx, updatePath, messageRequest{
+		Channel: target,
+		TS:      messageID,
+		Text:    text,
+		Blocks:  blocks,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating slack message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindSlack
+}
+
+// buildMessage generates the fallback text and the blocks for a domain.StreamInfo.
+func buildMessage(stream domain.StreamInfo) (string, []block) {
+	verb, status := "is", liveText
+	if !stream.IsOnline {
+		verb, status = "was", offlineText
+	}
+
+	var viewerInfo string
+	if stream.ViewerCount > -1 {
+		viewerInfo = fmt.Sprintf(" for %d viewers", stream.ViewerCount)
+	}
+
+	text := fmt.Sprintf("%s %s streaming %s%s", stream.Username, verb, stream.Title, viewerInfo)
+
+	blocks := []block{
+		{
+			"type": "section",
+			"text": block{
+				"type": "mrkdwn",
+				"text": fmt.Sprintf("*<%s|%s>* %s streaming %s%s",
+					stream.URL, escape(stream.Username), verb, escape(stream.Title), viewerInfo),
+			},
+		},
+	}
+
+	if stream.IsOnline && stream.ThumbnailURL != "" {
+		blocks = append(blocks, block{
+			"type": "image",
+			// cache busting, slack caches images by URL
+			"image_url": fmt.Sprintf("%s?time=%d", stream.ThumbnailURL, time.Now().Unix()),
+			"alt_text":  stream.Username + " stream thumbnail",
+		})
+	}
+
+	if stream.URL != "" {
+		blocks = append(blocks, block{
+			"type": "actions",
+			"elements": []block{
+				{
+					"type": "button",
+					"text": block{"type": "plain_text", "text": "Watch stream"},
+					"url":  stream.URL,
+				},
+			},
+		})
+	}
+
+	blocks = append(blocks, block{
+		"type":     "context",
+		"elements": []block{{"type": "mrkdwn", "text": status}},
+	})
+
+	return text, blocks
+}
+
+// escape replaces the control characters of Slack mrkdwn.
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// call invokes a Web API method, waiting and retrying as long as the request is rate limited.
+func (s *Sender) call(ctx context.Context, method string, message messageRequest) (messageResponse, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return messageResponse{}, fmt.Errorf("error encoding slack message: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, retryAfter, err := s.post(ctx, method, body)
+		if err == nil {
+			return response, nil
+		}
+		if retryAfter == 0 || attempt >= s.config.MaxRetries {
+			return messageResponse{}, err
+		}
+
+		log.Warn().Str("method", method).Dur("retryAfter", retryAfter).Msg("slack rate limit hit, waiting")
+
+		select {
+		case <-ctx.Done():
+			return messageResponse{}, fmt.Errorf("error waiting for slack rate limit: %w", ctx.Err())
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// post sends a single request, returning the time to wait if the request was rate limited.
+func (s *Sender) post(ctx context.Context, method string, body []byte) (messageResponse, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackAPIURL+method, bytes.NewReader(body))
+	if err != nil {
+		return messageResponse{}, 0, fmt.Errorf("error building request for slack: %w", err)
+	}
+
+	req.Header.Set("Content-Type", slackMimeType)
+	req.Header.Set("Authorization", "Bearer "+s.config.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return messageResponse{}, 0, fmt.Errorf("error making request to slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return messageResponse{}, parseRetryAfter(resp.Header.Get("Retry-After")), errors.New(rateLimitedError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return messageResponse{}, 0, fmt.Errorf("unexpected response from slack: %d", resp.StatusCode)
+	}
+
+	var response messageResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return messageResponse{}, 0, fmt.Errorf("error decoding response from slack: %w", err)
+	}
+
+	if !response.OK {
+		if response.Error == rateLimitedError {
+			return messageResponse{}, parseRetryAfter(resp.Header.Get("Retry-After")), errors.New(rateLimitedError)
+		}
+		return messageResponse{}, 0, fmt.Errorf("slack returned error: %s", response.Error)
+	}
+
+	return response, 0, nil
+}
+
+func parseRetryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return defaultRetryAfter
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+const DefaultPath = "streamobserver.db"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id         INTEGER PRIMARY KEY,
+	kind       TEXT    NOT NULL,
+	user_id    TEXT    NOT NULL,
+	base_url   TEXT    NOT NULL DEFAULT '',
+	started_at INTEGER NOT NULL,
+	ended_at   INTEGER,
+	updated_at INTEGER NOT NULL,
+	UNIQUE (kind, user_id, base_url, started_at)
+);
+CREATE TABLE IF NOT EXISTS session_changes (
+	session_id INTEGER NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+	time       INTEGER NOT NULL,
+	title      TEXT    NOT NULL,
+	category   TEXT    NOT NULL
+);
+CREATE TABLE IF NOT EXISTS viewer_samples (
+	session_id INTEGER NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+	time       INTEGER NOT NULL,
+	viewers    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS session_changes_session ON session_changes (session_id, time);
+CREATE INDEX IF NOT EXISTS viewer_samples_session ON viewer_samples (session_id);
+`
+
+// SessionStore records the sessions of observed streams with their title changes and viewer samples in a SQLite
+// database. Peak and average viewers are aggregated from the samples, so restarts during a session lose nothing.
+type SessionStore struct {
+	db *sql.DB
+}
+
+var _ port.SessionStore = (*SessionStore)(nil)
+
+// NewSessionStore opens or creates the database at path.
+func NewSessionStore(path string) (*SessionStore, error) {
+	db, err := open(path, schema)
+	if err != nil {
+		return nil, fmt.Errorf("error opening session database: %w", err)
+	}
+
+	return &SessionStore{db: db}, nil
+}
+
+// open opens or creates the database at path, DefaultPath if empty, and creates the tables of a schema.
+func open(path string, schema string) (*sql.DB, error) {
+	if path == "" {
+		path = DefaultPath
+	}
+
+	// WAL allows reading the statistics from the CLI while the service is writing
+	dsn := "file:" + path +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating tables in %s: %w", path, err)
+	}
+
+	log.Debug().Str("path", path).Msg("opened database")
+
+	return db, nil
+}
+
+func (s *SessionStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SessionStore) SaveSession(ctx context.Context,
+	query domain.StreamQuery,
+	session domain.Session,
+	viewers int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting session transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	now := time.Now().Unix()
+
+	var ended sql.NullInt64
+	if !session.Live() {
+		ended = sql.NullInt64{Int64: session.EndedAt.Unix(), Valid: true}
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO sessions (kind, user_id, base_url, started_at, ended_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (kind, user_id, base_url, started_at)
+		DO UPDATE SET ended_at = excluded.ended_at, updated_at = excluded.updated_at
+		RETURNING id`,
+		string(query.Kind), query.UserID, query.BaseURL, session.StartedAt.Unix(), ended, now).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+
+	// changes are appended one per poll at most, the latest is stored unless it is stored already
+	if len(session.Changes) > 0 {
+		change := session.Changes[len(session.Changes)-1]
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO session_changes (session_id, time, title, category)
+			SELECT ?, ?, ?, ?
+			WHERE NOT EXISTS (
+				SELECT 1 FROM session_changes
+				WHERE session_id = ? AND title = ? AND category = ?
+				AND time = (SELECT MAX(time) FROM session_changes WHERE session_id = ?)
+			)`,
+			id, change.Time.Unix(), change.Title, change.Category, id, change.Title, change.Category, id)
+		if err != nil {
+			return fmt.Errorf("error saving session change: %w", err)
+		}
+	}
+
+	if viewers >= 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO viewer_samples (session_id, time, viewers) VALUES (?, ?, ?)`,
+			id, now, viewers)
+		if err != nil {
+			return fmt.Errorf("error saving viewer sample: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SessionStore) Sessions(ctx context.Context,
+	query domain.StreamQuery,
+	since time.Time) ([]domain.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.started_at, COALESCE(s.ended_at, s.updated_at),
+			COALESCE(MAX(v.viewers), 0), COALESCE(SUM(v.viewers), 0), COUNT(v.viewers)
+		FROM sessions s
+		LEFT JOIN viewer_samples v ON v.session_id = s.id
+		WHERE s.kind = ? AND s.user_id = ? AND s.base_url = ? AND s.started_at >= ?
+		GROUP BY s.id
+		ORDER BY s.started_at`,
+		string(query.Kind), query.UserID, query.BaseURL, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]domain.Session, 0)
+	index := make(map[int64]int)
+	for rows.Next() {
+		var id, started, ended int64
+		var session domain.Session
+		err = rows.Scan(&id, &started, &ended, &session.PeakViewers, &session.ViewerSum, &session.Samples)
+		if err != nil {
+			return nil, fmt.Errorf("error reading session: %w", err)
+		}
+		session.StartedAt = time.Unix(started, 0)
+		session.EndedAt = time.Unix(ended, 0)
+		index[id] = len(sessions)
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading sessions: %w", err)
+	}
+
+	err = s.loadChanges(ctx, query, since, sessions, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// loadChanges adds the title and category changes to the sessions of a stream, index maps session IDs to sessions.
+func (s *SessionStore) loadChanges(ctx context.Context,
+	query domain.StreamQuery,
+	since time.Time,
+	sessions []domain.Session,
+	index map[int64]int) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.session_id, c.time, c.title, c.category
+		FROM session_changes c
+		JOIN sessions s ON s.id = c.session_id
+		WHERE s.kind = ? AND s.user_id = ? AND s.base_url = ? AND s.started_at >= ?
+		ORDER BY c.session_id, c.time`,
+		string(query.Kind), query.UserID, query.BaseURL, since.Unix())
+	if err != nil {
+		return fmt.Errorf("error querying session changes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, changed int64
+		var change domain.SessionChange
+		err = rows.Scan(&id, &changed, &change.Title, &change.Category)
+		if err != nil {
+			return fmt.Errorf("error reading session change: %w", err)
+		}
+		change.Time = time.Unix(changed, 0)
+
+		if i, ok := index[id]; ok {
+			sessions[i].Changes = append(sessions[i].Changes, change)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error reading session changes: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SessionStore) Streams(ctx context.Context) ([]domain.StreamQuery, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT DISTINCT kind, user_id, base_url FROM sessions ORDER BY kind, user_id, base_url`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying streams: %w", err)
+	}
+	defer rows.Close()
+
+	streams := make([]domain.StreamQuery, 0)
+	for rows.Next() {
+		var kind string
+		var query domain.StreamQuery
+		err = rows.Scan(&kind, &query.UserID, &query.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stream: %w", err)
+		}
+		query.Kind = domain.StreamKind(kind)
+		streams = append(streams, query)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading streams: %w", err)
+	}
+
+	return streams, nil
+}
@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"time"
+)
+
+const subscriptionSchema = `
+CREATE TABLE IF NOT EXISTS subscriptions (
+	target         TEXT    NOT NULL,
+	kind           TEXT    NOT NULL,
+	user_id        TEXT    NOT NULL,
+	base_url       TEXT    NOT NULL DEFAULT '',
+	custom_url     TEXT    NOT NULL DEFAULT '',
+	offline_policy TEXT    NOT NULL DEFAULT '',
+	created_at     INTEGER NOT NULL,
+	PRIMARY KEY (target, kind, user_id, base_url, custom_url)
+);
+CREATE TABLE IF NOT EXISTS metadata (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// seededKey marks the subscriptions as seeded in the metadata table.
+const seededKey = "subscriptions_seeded"
+
+// SubscriptionStore persists the subscriptions of all notification targets in a SQLite database.
+type SubscriptionStore struct {
+	db *sql.DB
+}
+
+var _ port.SubscriptionStore = (*SubscriptionStore)(nil)
+
+// NewSubscriptionStore opens or creates the database at path, it may be shared with the SessionStore.
+func NewSubscriptionStore(path string) (*SubscriptionStore, error) {
+	db, err := open(path, subscriptionSchema)
+	if err != nil {
+		return nil, fmt.Errorf("error opening subscription database: %w", err)
+	}
+
+	return &SubscriptionStore{db: db}, nil
+}
+
+func (s *SubscriptionStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SubscriptionStore) Seed(ctx context.Context, subscriptions []domain.Subscription) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting seed transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var seeded string
+	err = tx.QueryRowContext(ctx, `SELECT value FROM metadata WHERE key = ?`, seededKey).Scan(&seeded)
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, fmt.Errorf("error checking subscription seed: %w", err)
+	}
+
+	for _, subscription := range subscriptions {
+		err = insertSubscription(ctx, tx, subscription)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO metadata (key, value) VALUES (?, ?)`,
+		seededKey, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("error marking subscriptions as seeded: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("error committing subscription seed: %w", err)
+	}
+
+	return true, nil
+}
+
+func (s *SubscriptionStore) Subscriptions(ctx context.Context) ([]domain.Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT target, kind, user_id, base_url, custom_url, offline_policy FROM subscriptions
+		ORDER BY created_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subscriptions := make([]domain.Subscription, 0)
+	for rows.Next() {
+		var target, kind, policy string
+		var subscription domain.Subscription
+		err = rows.Scan(&target, &kind, &subscription.Query.UserID, &subscription.Query.BaseURL,
+			&subscription.Query.CustomURL, &policy)
+		if err != nil {
+			return nil, fmt.Errorf("error reading subscription: %w", err)
+		}
+
+		subscription.Target, err = domain.ParseTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		subscription.Query.Kind = domain.StreamKind(kind)
+		subscription.OfflinePolicy = domain.OfflinePolicy(policy)
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (s *SubscriptionStore) AddSubscription(ctx context.Context, subscription domain.Subscription) error {
+	return insertSubscription(ctx, s.db, subscription)
+}
+
+func (s *SubscriptionStore) RemoveSubscription(ctx context.Context,
+	target domain.Target,
+	query domain.StreamQuery) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM subscriptions
+		WHERE target = ? AND kind = ? AND user_id = ? AND base_url = ? AND custom_url = ?`,
+		target.String(), string(query.Kind), query.UserID, query.BaseURL, query.CustomURL)
+	if err != nil {
+		return fmt.Errorf("error deleting subscription: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error deleting subscription: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("subscription of %s to %s/%s %w", target, query.Kind, query.UserID, domain.ErrNotFound)
+	}
+
+	return nil
+}
+
+// execer is implemented by sql.DB and sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertSubscription(ctx context.Context, db execer, subscription domain.Subscription) error {
+	query := subscription.Query
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO subscriptions (target, kind, user_id, base_url, custom_url, offline_policy, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (target, kind, user_id, base_url, custom_url)
+		DO UPDATE SET offline_policy = excluded.offline_policy`,
+		subscription.Target.String(), string(query.Kind), query.UserID, query.BaseURL, query.CustomURL,
+		string(subscription.OfflinePolicy), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("error saving subscription: %w", err)
+	}
+	return nil
+}
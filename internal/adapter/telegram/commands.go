@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"context"
+	"html"
+	"strconv"
+	"streamobserver/internal/core/port"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog/log"
+)
+
+const commandStats = "/stats"
+
+// HandleStats answers "/stats <stream> [days]" with the session statistics of a stream and starts receiving updates.
+// Commands are only answered in the given chats.
+func (s *Sender) HandleStats(stats port.StatsReporter, chats []int64) {
+	allowed := make(map[int64]bool, len(chats))
+	for _, chatID := range chats {
+		allowed[chatID] = true
+	}
+
+	s.b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
+		return update.Message != nil && isCommand(update.Message.Text, commandStats)
+	}, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		message := update.Message
+		if !allowed[message.Chat.ID] {
+			log.Debug().Int64("chat", message.Chat.ID).Msg("ignoring telegram command from unknown chat")
+			return
+		}
+
+		s.replyStats(ctx, stats, message)
+	})
+
+	go s.b.Start(context.Background())
+
+	log.Info().Msg("listening for telegram commands")
+}
+
+func (s *Sender) replyStats(ctx context.Context, stats port.StatsReporter, message *models.Message) {
+	args := strings.Fields(message.Text)[1:]
+
+	var text string
+	switch {
+	case len(args) == 0 || len(args) > 2:
+		streams, err := stats.Streams(ctx)
+		if err != nil {
+			log.Err(err).Msg("failed to list streams with statistics")
+		}
+		text = "Usage: /stats &lt;stream&gt; [days]"
+		if len(streams) > 0 {
+			text += "\nStreams: " + html.EscapeString(strings.Join(streams, ", "))
+		}
+	default:
+		var since time.Time
+		if len(args) == 2 {
+			days, err := strconv.Atoi(args[1])
+			if err != nil || days <= 0 {
+				text = "Invalid number of days " + html.EscapeString(args[1])
+				break
+			}
+			since = time.Now().AddDate(0, 0, -days)
+		}
+
+		report, err := stats.Report(ctx, args[0], since)
+		if err != nil {
+			log.Debug().Err(err).Str("stream", args[0]).Msg("failed to report stream statistics")
+			text = html.EscapeString(err.Error())
+			break
+		}
+		text = "<pre>" + html.EscapeString(report) + "</pre>"
+	}
+
+	_, err := request(ctx, s, message.Chat.ID, "", s.b.SendMessage, &bot.SendMessageParams{
+		ChatID:          message.Chat.ID,
+		MessageThreadID: message.MessageThreadID,
+		Text:            text,
+		ParseMode:       models.ParseModeHTML,
+		ReplyParameters: &models.ReplyParameters{
+			MessageID:                message.ID,
+			AllowSendingWithoutReply: true,
+		},
+	})
+	if err != nil {
+		log.Err(err).Int64("chat", message.Chat.ID).Msg("failed to answer telegram command")
+	}
+}
+
+// isCommand checks whether a message starts with a command, which is suffixed with the bot name in groups.
+func isCommand(text string, command string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return false
+	}
+	name, _, _ := strings.Cut(fields[0], "@")
+	return strings.EqualFold(name, command)
+}
@@ -0,0 +1,110 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/port"
+	"strings"
+
+	"github.com/go-telegram/bot"
+)
+
+var (
+	// ErrMessageNotModified is returned by edits leaving a message unchanged.
+	ErrMessageNotModified error = &messageError{"telegram message not modified", "not_modified"}
+	// ErrMessageGone is returned for messages deleted in the meantime.
+	ErrMessageGone error = &messageError{"telegram message gone", "message_gone"}
+	// ErrMessageIncompatible is returned for edits not matching the message type, e.g. a caption edit of a text
+	// message.
+	ErrMessageIncompatible error = &messageError{"telegram message incompatible", "message_incompatible"}
+)
+
+var (
+	_ port.ClassifiedError = (*messageError)(nil)
+	_ port.ClassifiedError = (*apiError)(nil)
+)
+
+type messageError struct {
+	message string
+	class   string
+}
+
+func (e *messageError) Error() string {
+	return e.message
+}
+
+func (e *messageError) ErrorClass() string {
+	return e.class
+}
+
+// apiError reports the class of an error response of the Bot API.
+type apiError struct {
+	class string
+	err   error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+func (e *apiError) ErrorClass() string {
+	return e.class
+}
+
+// wrapAPIError wraps error responses of the Bot API into an apiError, other errors are returned unchanged.
+func wrapAPIError(err error) error {
+	var tooMany *bot.TooManyRequestsError
+	var class string
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &tooMany):
+		class = "rate_limited"
+	case errors.Is(err, bot.ErrorForbidden):
+		class = "forbidden"
+	case errors.Is(err, bot.ErrorUnauthorized):
+		class = "unauthorized"
+	case errors.Is(err, bot.ErrorNotFound):
+		class = "not_found"
+	case errors.Is(err, bot.ErrorBadRequest):
+		class = "bad_request"
+	default:
+		return err
+	}
+
+	return &apiError{class: class, err: err}
+}
+
+// classifyError wraps a bad request of the Bot API into one of the typed message errors, other errors are returned
+// unchanged. The Bot API only reports the reason in the error description.
+func classifyError(err error) error {
+	if err == nil || !errors.Is(err, bot.ErrorBadRequest) {
+		return err
+	}
+
+	description := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(description, "message is not modified"):
+		return fmt.Errorf("%w: %w", ErrMessageNotModified, err)
+	case strings.Contains(description, "message to edit not found"),
+		strings.Contains(description, "message to delete not found"),
+		strings.Contains(description, "message_id_invalid"),
+		strings.Contains(description, "message can't be edited"):
+		return fmt.Errorf("%w: %w", ErrMessageGone, err)
+	case strings.Contains(description, "there is no text in the message to edit"),
+		strings.Contains(description, "there is no caption in the message to edit"),
+		strings.Contains(description, "there is no media in the message to edit"):
+		return fmt.Errorf("%w: %w", ErrMessageIncompatible, err)
+	default:
+		return err
+	}
+}
+
+func isThreadNotFound(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "message thread not found")
+}
@@ -0,0 +1,139 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog/log"
+)
+
+const refreshTimeout = 30 * time.Second
+
+// liveTracker remembers the messages of live streams, to refresh their thumbnails and to know their message type.
+type liveTracker struct {
+	mu       sync.Mutex
+	messages map[liveKey]liveMessage
+}
+
+type liveKey struct {
+	chatID    int64
+	messageID int
+}
+
+type liveMessage struct {
+	target    string
+	stream    domain.StreamInfo
+	photo     bool
+	refreshed time.Time
+}
+
+func newLiveTracker() *liveTracker {
+	return &liveTracker{messages: make(map[liveKey]liveMessage)}
+}
+
+func (lt *liveTracker) get(key liveKey) (liveMessage, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	m, ok := lt.messages[key]
+	return m, ok
+}
+
+// update stores the latest info of a live message, messages of offline streams are dropped.
+func (lt *liveTracker) update(key liveKey, m liveMessage) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if !m.stream.IsOnline {
+		delete(lt.messages, key)
+		return
+	}
+	lt.messages[key] = m
+}
+
+func (lt *liveTracker) remove(key liveKey) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	delete(lt.messages, key)
+}
+
+// due returns the photo messages whose thumbnail is older than interval.
+func (lt *liveTracker) due(interval time.Duration) map[liveKey]liveMessage {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	due := make(map[liveKey]liveMessage)
+	for key, m := range lt.messages {
+		if m.photo && m.stream.ThumbnailURL != "" && time.Since(m.refreshed) >= interval {
+			due[key] = m
+		}
+	}
+	return due
+}
+
+// refreshThumbnails periodically replaces the photo of live messages with a current thumbnail.
+func (s *Sender) refreshThumbnails(interval time.Duration) {
+	for range time.Tick(interval) {
+		for key, m := range s.live.due(interval) {
+			ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+			err := s.refreshThumbnail(ctx, key, m)
+			cancel()
+			if err != nil {
+				log.Warn().Err(err).Int64("chat", key.chatID).Int("message", key.messageID).
+					Msg("failed to refresh telegram thumbnail")
+			}
+		}
+	}
+}
+
+func (s *Sender) refreshThumbnail(ctx context.Context, key liveKey, m liveMessage) error {
+	caption, err := s.caption(m.target, m.stream)
+	if err != nil {
+		return err
+	}
+
+	_, err = request(ctx, s, key.chatID, "media/"+messageKey(key.chatID, key.messageID), s.b.EditMessageMedia,
+		&bot.EditMessageMediaParams{
+			ChatID:    key.chatID,
+			MessageID: key.messageID,
+			Media: &models.InputMediaPhoto{
+				Media:     thumbnailURL(m.stream),
+				Caption:   caption,
+				ParseMode: s.parseMode,
+			},
+			ReplyMarkup: s.keyboard(m.target, m.stream),
+		})
+	err = classifyError(err)
+	if errors.Is(err, ErrMessageGone) {
+		// the next stream update resends the message
+		s.live.remove(key)
+		return nil
+	}
+	if err != nil && !errors.Is(err, ErrMessageNotModified) {
+		return fmt.Errorf("error editing telegram media: %w", err)
+	}
+
+	log.Debug().Int64("chat", key.chatID).Int("message", key.messageID).Msg("refreshed telegram thumbnail")
+
+	// the stream may have been updated or gone offline in the meantime, only the refresh time is updated
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	if current, ok := s.live.messages[key]; ok {
+		current.refreshed = time.Now()
+		s.live.messages[key] = current
+	}
+
+	return nil
+}
+
+// thumbnailURL busts the cache of Telegram, which caches photos by URL.
+func thumbnailURL(stream domain.StreamInfo) string {
+	return fmt.Sprintf("%s?time=%d", stream.ThumbnailURL, time.Now().Unix())
+}
@@ -0,0 +1,166 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	PinNone   = "none"
+	PinSilent = "silent"
+	PinNotify = "notify"
+
+	// pinRightsTTL is the time after which missing pin rights are checked again.
+	pinRightsTTL = time.Hour
+)
+
+// pinTracker remembers the messages pinned per chat and the pin rights of the bot.
+type pinTracker struct {
+	modes map[int64]string
+
+	mu     sync.Mutex
+	pinned map[int64]map[int]bool
+	rights map[int64]pinRights
+	warned map[int64]bool
+}
+
+type pinRights struct {
+	allowed bool
+	checked time.Time
+}
+
+func newPinTracker(modes map[int64]string) (*pinTracker, error) {
+	pt := &pinTracker{
+		modes:  make(map[int64]string),
+		pinned: make(map[int64]map[int]bool),
+		rights: make(map[int64]pinRights),
+		warned: make(map[int64]bool),
+	}
+
+	for chatID, mode := range modes {
+		mode = strings.ToLower(mode)
+		switch mode {
+		case "", PinNone:
+		case PinSilent, PinNotify:
+			pt.modes[chatID] = mode
+		default:
+			return nil, fmt.Errorf("invalid pin mode %q for telegram chat %d", mode, chatID)
+		}
+	}
+
+	return pt, nil
+}
+
+// pin pins a go-live message if enabled for the chat. Failures are logged, the message was sent anyway.
+func (s *Sender) pin(ctx context.Context, chatID int64, messageID int) {
+	mode, ok := s.pins.modes[chatID]
+	if !ok || !s.canPin(ctx, chatID) {
+		return
+	}
+
+	_, err := request(ctx, s, chatID, "", s.b.PinChatMessage, &bot.PinChatMessageParams{
+		ChatID:              chatID,
+		MessageID:           messageID,
+		DisableNotification: mode == PinSilent,
+	})
+	if err != nil {
+		log.Warn().Err(err).Int64("chat", chatID).Int("message", messageID).Msg("failed to pin telegram message")
+		return
+	}
+
+	s.pins.mu.Lock()
+	defer s.pins.mu.Unlock()
+	if s.pins.pinned[chatID] == nil {
+		s.pins.pinned[chatID] = make(map[int]bool)
+	}
+	s.pins.pinned[chatID][messageID] = true
+}
+
+// unpin unpins a message if it was pinned by the bot, other pins of the chat are kept.
+func (s *Sender) unpin(ctx context.Context, chatID int64, messageID int) {
+	if !s.pins.forget(chatID, messageID) {
+		return
+	}
+
+	_, err := request(ctx, s, chatID, "", s.b.UnpinChatMessage, &bot.UnpinChatMessageParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+	})
+	if err != nil {
+		log.Warn().Err(err).Int64("chat", chatID).Int("message", messageID).Msg("failed to unpin telegram message")
+	}
+}
+
+// forget stops tracking a pinned message and reports whether it was pinned.
+func (pt *pinTracker) forget(chatID int64, messageID int) bool {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pinned := pt.pinned[chatID][messageID]
+	delete(pt.pinned[chatID], messageID)
+	return pinned
+}
+
+// canPin checks whether the bot may pin messages in a chat, warning once per chat if not.
+func (s *Sender) canPin(ctx context.Context, chatID int64) bool {
+	s.pins.mu.Lock()
+	rights, ok := s.pins.rights[chatID]
+	s.pins.mu.Unlock()
+	if ok && (rights.allowed || time.Since(rights.checked) < pinRightsTTL) {
+		return rights.allowed
+	}
+
+	allowed, err := s.checkPinRights(ctx, chatID)
+	if err != nil {
+		log.Warn().Err(err).Int64("chat", chatID).Msg("failed to check telegram pin rights")
+		return false
+	}
+
+	s.pins.mu.Lock()
+	defer s.pins.mu.Unlock()
+	s.pins.rights[chatID] = pinRights{allowed: allowed, checked: time.Now()}
+
+	if !allowed && !s.pins.warned[chatID] {
+		log.Warn().Int64("chat", chatID).
+			Msg("pinning is enabled, but the bot is not allowed to pin messages in this chat, grant the pin right")
+		s.pins.warned[chatID] = true
+	}
+
+	return allowed
+}
+
+func (s *Sender) checkPinRights(ctx context.Context, chatID int64) (bool, error) {
+	member, err := request(ctx, s, chatID, "", s.b.GetChatMember,
+		&bot.GetChatMemberParams{ChatID: chatID, UserID: s.b.ID()})
+	if err != nil {
+		return false, fmt.Errorf("error getting telegram chat member: %w", err)
+	}
+
+	switch member.Type {
+	case models.ChatMemberTypeOwner:
+		return true, nil
+	case models.ChatMemberTypeAdministrator:
+		return member.Administrator.CanPinMessages, nil
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted.CanPinMessages, nil
+	case models.ChatMemberTypeMember:
+		// members may pin in private chats and in groups allowing it to everyone
+		chat, err := request(ctx, s, chatID, "", s.b.GetChat, &bot.GetChatParams{ChatID: chatID})
+		if err != nil {
+			return false, fmt.Errorf("error getting telegram chat: %w", err)
+		}
+		if chat.Type == models.ChatTypePrivate {
+			return true, nil
+		}
+		return chat.Permissions != nil && chat.Permissions.CanPinMessages, nil
+	default:
+		return false, nil
+	}
+}
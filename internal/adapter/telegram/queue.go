@@ -0,0 +1,312 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultGlobalRate is the number of requests per second the Bot API allows for a bot.
+	DefaultGlobalRate = 30
+	// DefaultGroupRate is the number of messages per minute the Bot API allows in a group.
+	DefaultGroupRate = 20
+	// privateRate is the number of messages per second in a private chat.
+	privateRate = 1
+
+	maxRateLimitRetries = 5
+)
+
+// outbox queues the requests to the Bot API, limiting them globally and per chat by token buckets. Queued edits of
+// the same message are coalesced, only the latest state is sent.
+type outbox struct {
+	globalRate float64
+	groupRate  float64
+	// retryUnit is the unit of the retry_after of rate limit errors, seconds in the Bot API
+	retryUnit time.Duration
+
+	mu      sync.Mutex
+	queue   []*job
+	edits   map[string]*job
+	global  *bucket
+	chats   map[int64]*bucket
+	blocked time.Time
+	wake    chan struct{}
+}
+
+type job struct {
+	ctx     context.Context
+	chatID  int64
+	key     string
+	fn      func(ctx context.Context) (any, error)
+	retries int
+	waiters []chan result
+}
+
+type result struct {
+	value any
+	err   error
+}
+
+func newOutbox(globalRate float64, groupRate float64) *outbox {
+	if globalRate <= 0 {
+		globalRate = DefaultGlobalRate
+	}
+	if groupRate <= 0 {
+		groupRate = DefaultGroupRate
+	}
+
+	o := &outbox{
+		globalRate: globalRate,
+		groupRate:  groupRate,
+		retryUnit:  time.Second,
+		edits:      make(map[string]*job),
+		global:     newBucket(globalRate, globalRate),
+		chats:      make(map[int64]*bucket),
+		wake:       make(chan struct{}, 1),
+	}
+
+	go o.run()
+
+	return o
+}
+
+// enqueue queues a request to a chat and waits for its result. Requests with the same non-empty key replace a
+// queued request, all callers receive the result of the latest one.
+func enqueue[T any](ctx context.Context,
+	o *outbox,
+	chatID int64,
+	key string,
+	fn func(ctx context.Context) (T, error)) (T, error) {
+	done := make(chan result, 1)
+	call := func(ctx context.Context) (any, error) {
+		return fn(ctx)
+	}
+
+	o.mu.Lock()
+	if queued, ok := o.edits[key]; ok && key != "" {
+		queued.ctx = ctx
+		queued.fn = call
+		queued.waiters = append(queued.waiters, done)
+		log.Debug().Str("key", key).Msg("coalesced queued telegram request")
+	} else {
+		j := &job{ctx: ctx, chatID: chatID, key: key, fn: call, waiters: []chan result{done}}
+		o.queue = append(o.queue, j)
+		if key != "" {
+			o.edits[key] = j
+		}
+	}
+	o.mu.Unlock()
+	o.signal()
+
+	var zero T
+	select {
+	case <-ctx.Done():
+		return zero, fmt.Errorf("error waiting for telegram queue: %w", ctx.Err())
+	case r := <-done:
+		if r.err != nil {
+			return zero, r.err
+		}
+		value, _ := r.value.(T)
+		return value, nil
+	}
+}
+
+// request queues a Bot API method call to a chat, see enqueue.
+func request[P any, R any](ctx context.Context,
+	s *Sender,
+	chatID int64,
+	key string,
+	method func(context.Context, *P) (R, error),
+	params *P) (R, error) {
+	value, err := enqueue(ctx, s.outbox, chatID, key, func(ctx context.Context) (R, error) {
+		return method(ctx, params)
+	})
+	return value, wrapAPIError(err)
+}
+
+// messageKey identifies the edits of a message for coalescing.
+func messageKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%d/%d", chatID, messageID)
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run dispatches queued requests as soon as the buckets allow it.
+func (o *outbox) run() {
+	for {
+		j, wait := o.next()
+		if j != nil {
+			go o.execute(j)
+			continue
+		}
+
+		if wait <= 0 {
+			<-o.wake
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next takes the first request allowed by the buckets, or returns the time until one may be allowed.
+func (o *outbox) next() (*job, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.queue) == 0 {
+		return nil, 0
+	}
+
+	now := time.Now()
+	if now.Before(o.blocked) {
+		return nil, o.blocked.Sub(now)
+	}
+	if wait := o.global.wait(now); wait > 0 {
+		return nil, wait
+	}
+
+	var minWait time.Duration
+	for i, j := range o.queue {
+		if err := j.ctx.Err(); err != nil {
+			// the latest caller gave up, drop the request
+			o.remove(i)
+			j.deliver(nil, err)
+			return nil, time.Nanosecond
+		}
+
+		wait := o.chat(j.chatID).wait(now)
+		if wait > 0 {
+			if minWait == 0 || wait < minWait {
+				minWait = wait
+			}
+			continue
+		}
+
+		o.global.take(now)
+		o.chat(j.chatID).take(now)
+		o.remove(i)
+		return j, 0
+	}
+
+	return nil, minWait
+}
+
+func (o *outbox) remove(i int) {
+	j := o.queue[i]
+	o.queue = append(o.queue[:i], o.queue[i+1:]...)
+	if j.key != "" && o.edits[j.key] == j {
+		delete(o.edits, j.key)
+	}
+}
+
+// chat returns the bucket of a chat, groups have negative IDs.
+func (o *outbox) chat(chatID int64) *bucket {
+	b, ok := o.chats[chatID]
+	if !ok {
+		if chatID < 0 {
+			b = newBucket(o.groupRate/60, o.groupRate)
+		} else {
+			b = newBucket(privateRate, privateRate)
+		}
+		o.chats[chatID] = b
+	}
+	return b
+}
+
+// execute sends a request, requeueing it at the front if the Bot API asks to retry later.
+func (o *outbox) execute(j *job) {
+	value, err := j.fn(j.ctx)
+
+	var tooMany *bot.TooManyRequestsError
+	if errors.As(err, &tooMany) && j.retries < maxRateLimitRetries {
+		retryAfter := time.Duration(max(tooMany.RetryAfter, 1)) * o.retryUnit
+		log.Warn().Int64("chat", j.chatID).Dur("retryAfter", retryAfter).Msg("telegram rate limit hit, waiting")
+
+		j.retries++
+
+		o.mu.Lock()
+		until := time.Now().Add(retryAfter)
+		if j.chatID == 0 {
+			o.blocked = until
+		} else {
+			o.chat(j.chatID).block(until)
+		}
+		if queued, ok := o.edits[j.key]; ok && j.key != "" {
+			// a newer edit was queued meanwhile, it supersedes this one
+			queued.waiters = append(queued.waiters, j.waiters...)
+		} else {
+			o.queue = append([]*job{j}, o.queue...)
+			if j.key != "" {
+				o.edits[j.key] = j
+			}
+		}
+		o.mu.Unlock()
+		o.signal()
+		return
+	}
+
+	j.deliver(value, err)
+}
+
+func (j *job) deliver(value any, err error) {
+	for _, waiter := range j.waiters {
+		waiter <- result{value: value, err: err}
+	}
+}
+
+// bucket is a token bucket refilled continuously at rate tokens per second.
+type bucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	blocked  time.Time
+}
+
+func newBucket(rate float64, capacity float64) *bucket {
+	return &bucket{rate: rate, capacity: capacity, tokens: capacity, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns the time until a token is available.
+func (b *bucket) wait(now time.Time) time.Duration {
+	if now.Before(b.blocked) {
+		return b.blocked.Sub(now)
+	}
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
+
+func (b *bucket) block(until time.Time) {
+	b.blocked = until
+}
@@ -0,0 +1,186 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+const (
+	testTimeout = 5 * time.Second
+	groupChatID = -100123
+)
+
+// waitFor polls a condition on the outbox with its lock held until it is met.
+func waitFor(t *testing.T, o *outbox, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for {
+		o.mu.Lock()
+		met := condition()
+		o.mu.Unlock()
+		if met {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for outbox")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEnqueue_CoalescesEdits(t *testing.T) {
+	o := newOutbox(0, 0)
+	key := messageKey(groupChatID, 1)
+
+	// hold the queue until both edits are waiting
+	o.mu.Lock()
+	o.chat(groupChatID).block(time.Now().Add(time.Hour))
+	o.mu.Unlock()
+
+	var mu sync.Mutex
+	calls := make([]string, 0)
+	edit := func(text string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, text)
+			return text, nil
+		}
+	}
+
+	results := make(chan string, 2)
+	send := func(text string) {
+		value, err := enqueue(t.Context(), o, groupChatID, key, edit(text))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		results <- value
+	}
+
+	go send("first")
+	waitFor(t, o, func() bool { return o.edits[key] != nil })
+	go send("second")
+	waitFor(t, o, func() bool { return len(o.edits[key].waiters) == 2 })
+
+	o.mu.Lock()
+	o.chat(groupChatID).block(time.Time{})
+	o.mu.Unlock()
+	o.signal()
+
+	for range 2 {
+		select {
+		case value := <-results:
+			if value != "second" {
+				t.Errorf("expected every waiter to receive the latest edit, got %q", value)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("timed out waiting for result")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 || calls[0] != "second" {
+		t.Errorf("expected only the latest edit to be sent, got %v", calls)
+	}
+}
+
+func TestExecute_RetriesRateLimit(t *testing.T) {
+	o := newOutbox(0, 0)
+	o.retryUnit = 20 * time.Millisecond
+
+	var mu sync.Mutex
+	attempts := make([]time.Time, 0)
+	limited := func(context.Context) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		return false, &bot.TooManyRequestsError{Message: "Too Many Requests", RetryAfter: 1}
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := enqueue(t.Context(), o, groupChatID, "", limited)
+		errs <- err
+	}()
+
+	// a request to the same chat queued after the first rate limit waits for the blocked bucket
+	var blockedUntil time.Time
+	waitFor(t, o, func() bool {
+		blockedUntil = o.chat(groupChatID).blocked
+		return blockedUntil.After(time.Now())
+	})
+	sent, err := enqueue(t.Context(), o, groupChatID, "", func(context.Context) (time.Time, error) {
+		return time.Now(), nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sent.Before(blockedUntil) {
+		t.Errorf("expected request to wait for the blocked chat until %s, sent at %s", blockedUntil, sent)
+	}
+
+	select {
+	case err := <-errs:
+		var tooMany *bot.TooManyRequestsError
+		if !errors.As(err, &tooMany) {
+			t.Errorf("expected rate limit error after the last retry, got %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for rate limited request")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 1+maxRateLimitRetries {
+		t.Errorf("expected %d attempts, got %d", 1+maxRateLimitRetries, len(attempts))
+	}
+	for i := 1; i < len(attempts); i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < o.retryUnit {
+			t.Errorf("expected retry %d to wait for retry_after, waited %s", i, gap)
+		}
+	}
+}
+
+func TestNext_DropsCancelledRequests(t *testing.T) {
+	o := newOutbox(0, 0)
+
+	o.mu.Lock()
+	o.chat(groupChatID).block(time.Now().Add(time.Hour))
+	o.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	called := make(chan struct{}, 1)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := enqueue(ctx, o, groupChatID, "", func(context.Context) (bool, error) {
+			called <- struct{}{}
+			return true, nil
+		})
+		errs <- err
+	}()
+
+	waitFor(t, o, func() bool { return len(o.queue) == 1 })
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled wait, got %v", err)
+	}
+
+	o.mu.Lock()
+	o.chat(groupChatID).block(time.Time{})
+	o.mu.Unlock()
+	o.signal()
+
+	waitFor(t, o, func() bool { return len(o.queue) == 0 })
+	select {
+	case <-called:
+		t.Error("expected cancelled request not to be sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html"
+	"strconv"
 	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
 	"time"
 
 	"github.com/go-telegram/bot"
@@ -13,110 +17,541 @@ import (
 )
 
 const (
-	liveText    = "🔴 LIVE"
-	offlineText = "❌ OFFLINE"
+	ParseModeNone       = "none"
+	ParseModeHTML       = "html"
+	ParseModeMarkdownV2 = "markdownv2"
 )
 
+// Config holds the message settings of the Telegram bot.
+type Config struct {
+	// ParseMode of the rendered templates: none, html or markdownv2.
+	ParseMode string
+	// Buttons adds inline keyboard buttons linking the stream, or the VOD once the stream is offline, next to an
+	// optional secondary link.
+	Buttons bool
+	// Links holds the secondary link button per stream, streams without a link get a VOD button while live.
+	Links map[domain.StreamQuery]Link
+	// TopicsFile persists the forum topics created per streamer.
+	TopicsFile string
+	// Pins holds the pin mode of go-live messages per chat ID: none, silent or notify.
+	Pins map[int64]string
+	// ThumbnailRefresh is the interval of replacing the photo of live messages with a current thumbnail, zero
+	// disables refreshing.
+	ThumbnailRefresh time.Duration
+	// GlobalRate limits the requests per second, GroupRate the messages per minute in a group.
+	GlobalRate float64
+	GroupRate  float64
+}
+
+// Link is a secondary button of a stream message, linking a custom page.
+type Link struct {
+	URL string
+	// Text of the button, a generic translated label if empty
+	Text string
+}
+
 type Sender struct {
-	b *bot.Bot
+	b         *bot.Bot
+	renderer  port.MessageRenderer
+	config    Config
+	parseMode models.ParseMode
+	escape    func(string) string
+	topics    *topicStore
+	pins      *pinTracker
+	live      *liveTracker
+	outbox    *outbox
 }
 
-func NewTelegramSender(b *bot.Bot) *Sender {
-	return &Sender{b: b}
+var (
+	_ port.Notifier          = (*Sender)(nil)
+	_ port.MessageDeleter    = (*Sender)(nil)
+	_ port.MessageReplier    = (*Sender)(nil)
+	_ port.MessageReplacer   = (*Sender)(nil)
+	_ port.StreamEndListener = (*Sender)(nil)
+	_ port.DigestSender      = (*Sender)(nil)
+	_ port.HealthChecker     = (*Sender)(nil)
+)
+
+func NewTelegramSender(b *bot.Bot, renderer port.MessageRenderer, config Config) (*Sender, error) {
+	s := &Sender{
+		b:        b,
+		renderer: renderer,
+		config:   config,
+		live:     newLiveTracker(),
+		outbox:   newOutbox(config.GlobalRate, config.GroupRate),
+	}
+
+	switch strings.ToLower(config.ParseMode) {
+	case "", ParseModeNone:
+	case ParseModeHTML:
+		s.parseMode = models.ParseModeHTML
+		s.escape = html.EscapeString
+	case ParseModeMarkdownV2:
+		s.parseMode = models.ParseModeMarkdown
+		s.escape = domain.EscapeMarkdownV2
+	default:
+		return nil, fmt.Errorf("invalid telegram parse mode %q", config.ParseMode)
+	}
+
+	if config.TopicsFile == "" {
+		config.TopicsFile = DefaultTopicsFile
+	}
+	topics, err := newTopicStore(config.TopicsFile)
+	if err != nil {
+		return nil, err
+	}
+	s.topics = topics
+
+	s.pins, err = newPinTracker(config.Pins)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ThumbnailRefresh > 0 {
+		go s.refreshThumbnails(config.ThumbnailRefresh)
+	}
+
+	return s, nil
 }
 
-// SendStreamInfo generates a message from a domain.StreamInfo and sends it to a chat ID.
-func (s *Sender) SendStreamInfo(ctx context.Context, chatID int64, stream domain.StreamInfo) (int, error) {
-	var viewerInfo string
-	if stream.ViewerCount > -1 {
-		viewerInfo = fmt.Sprintf("for %d viewers", stream.ViewerCount)
+// SendStreamInfo generates a message from a domain.StreamInfo and sends it to a chat ID, optionally into a forum
+// topic given as "chatID/topic".
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	chatID, topic, err := parseTarget(target)
+	if err != nil {
+		return "", err
 	}
 
-	caption := fmt.Sprintf("%s is streaming %s %s\n%s\n[%s]",
-		stream.Username, stream.Title, viewerInfo, stream.URL, liveText)
+	caption, err := s.caption(target, stream)
+	if err != nil {
+		return "", err
+	}
 
-	var message *models.Message
-	var err error
-	if stream.ThumbnailURL == "" {
-		message, err = s.b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: chatID,
-			Text:   caption,
-		})
-		if err != nil {
-			return -1, fmt.Errorf("error sending telegram message: %w", err)
-		}
-	} else {
-		message, err = s.b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID: chatID,
-			Photo: &models.InputFileString{
-				Data: fmt.Sprintf(
-					"%s?time=%d",
-					stream.ThumbnailURL,
-					time.Now().Unix()),
-			},
-			Caption: caption,
-		})
+	threadID, err := s.threadID(ctx, chatID, topic, stream)
+	if err != nil {
+		return "", err
+	}
+
+	message, err := s.send(ctx, chatID, threadID, target, caption, stream)
+	if err != nil && isThreadNotFound(err) && s.forgetTopic(chatID, topic, stream) {
+		log.Warn().Int64("chat", chatID).Int("thread", threadID).Msg("telegram forum topic is gone, recreating")
+
+		threadID, err = s.threadID(ctx, chatID, topic, stream)
 		if err != nil {
-			return -1, fmt.Errorf("error sending telegram photo: %w", err)
+			return "", err
 		}
+		message, err = s.send(ctx, chatID, threadID, target, caption, stream)
+	}
+	if err != nil {
+		return "", err
 	}
 
 	log.Debug().Interface("Message", message).Msg("Sent message.")
 
 	if message.Chat.ID != chatID {
-		return -1, errors.New("returned invalid chat id")
+		return "", errors.New("returned invalid chat id")
 	}
 
-	return message.ID, nil
+	s.pin(ctx, chatID, message.ID)
+
+	s.live.update(liveKey{chatID: chatID, messageID: message.ID}, liveMessage{
+		target:    target,
+		stream:    stream,
+		photo:     stream.ThumbnailURL != "",
+		refreshed: time.Now(),
+	})
+
+	return strconv.Itoa(message.ID), nil
 }
 
-// UpdateStreamInfo generates a message from a domain.StreamInfo and sends it to a chat ID.
-func (s *Sender) UpdateStreamInfo(ctx context.Context, chatID int64, messageID int, stream domain.StreamInfo) error {
-	var verb string
-	var status string
+func (s *Sender) send(ctx context.Context,
+	chatID int64,
+	threadID int,
+	target string,
+	caption string,
+	stream domain.StreamInfo) (*models.Message, error) {
+	if stream.ThumbnailURL == "" {
+		message, err := request(ctx, s, chatID, "", s.b.SendMessage, &bot.SendMessageParams{
+			ChatID:          chatID,
+			MessageThreadID: threadID,
+			Text:            caption,
+			ParseMode:       s.parseMode,
+			ReplyMarkup:     s.keyboard(target, stream),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error sending telegram message: %w", err)
+		}
+		return message, nil
+	}
 
-	if stream.IsOnline {
-		verb = "is"
-		status = liveText
-	} else {
-		verb = "was"
-		status = offlineText
+	message, err := request(ctx, s, chatID, "", s.b.SendPhoto, &bot.SendPhotoParams{
+		ChatID:          chatID,
+		MessageThreadID: threadID,
+		Photo:           &models.InputFileString{Data: thumbnailURL(stream)},
+		Caption:         caption,
+		ParseMode:       s.parseMode,
+		ReplyMarkup:     s.keyboard(target, stream),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error sending telegram photo: %w", err)
 	}
-	var viewerInfo string
-	if stream.ViewerCount > -1 {
-		viewerInfo = fmt.Sprintf("for %d viewers", stream.ViewerCount)
+	return message, nil
+}
+
+// UpdateStreamInfo generates a message from a domain.StreamInfo and edits a previously sent message.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	_, err := s.ReplaceStreamInfo(ctx, target, messageID, stream)
+	return err
+}
+
+// ReplaceStreamInfo edits a previously sent message. A text-only message of a live stream is replaced by a photo
+// message once a thumbnail is available, as is a message that was deleted or can not be edited, returning the ID of
+// the new message.
+func (s *Sender) ReplaceStreamInfo(ctx context.Context,
+	target string,
+	messageID string,
+	stream domain.StreamInfo) (string, error) {
+	chatID, _, err := parseTarget(target)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return "", fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
 	}
 
-	caption := fmt.Sprintf("%s %s streaming %s %s\n%s\n[%s]", stream.Username, verb, stream.Title,
-		viewerInfo, stream.URL, status)
+	if !stream.IsOnline {
+		defer s.unpin(ctx, chatID, id)
+	}
+
+	caption, err := s.caption(target, stream)
+	if err != nil {
+		return "", err
+	}
+
+	key := liveKey{chatID: chatID, messageID: id}
+	tracked, ok := s.live.get(key)
+	if !ok {
+		tracked = liveMessage{photo: stream.ThumbnailURL != "", refreshed: time.Now()}
+	}
+
+	if stream.IsOnline && !tracked.photo && stream.ThumbnailURL != "" {
+		return s.resend(ctx, chatID, id, target, caption, stream)
+	}
 
 	var message *models.Message
-	var err error
-	if stream.ThumbnailURL == "" {
-		message, err = s.b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:    chatID,
-			MessageID: messageID,
-			Text:      caption,
+	if !tracked.photo {
+		message, err = request(ctx, s, chatID, messageKey(chatID, id), s.b.EditMessageText, &bot.EditMessageTextParams{
+			ChatID:      chatID,
+			MessageID:   id,
+			Text:        caption,
+			ParseMode:   s.parseMode,
+			ReplyMarkup: s.keyboard(target, stream),
 		})
-		if err != nil {
-			return fmt.Errorf("error editing telegram message: %w", err)
-		}
 	} else {
-		message, err = s.b.EditMessageCaption(ctx, &bot.EditMessageCaptionParams{
-			ChatID:    chatID,
-			MessageID: messageID,
-			Caption:   caption,
-		})
+		message, err = request(ctx, s, chatID, messageKey(chatID, id), s.b.EditMessageCaption,
+			&bot.EditMessageCaptionParams{
+				ChatID:      chatID,
+				MessageID:   id,
+				Caption:     caption,
+				ParseMode:   s.parseMode,
+				ReplyMarkup: s.keyboard(target, stream),
+			})
+	}
+
+	err = classifyError(err)
+	switch {
+	case errors.Is(err, ErrMessageNotModified):
+		log.Debug().Int64("chat", chatID).Int("message", id).Msg("telegram message not modified")
+	case errors.Is(err, ErrMessageGone) && !stream.IsOnline:
+		// no need to bring back a deleted message once the stream is over
+		log.Info().Int64("chat", chatID).Int("message", id).Msg("telegram message is gone, not resending")
+		s.pins.forget(chatID, id)
+		s.live.remove(key)
+		return messageID, nil
+	case errors.Is(err, ErrMessageGone), errors.Is(err, ErrMessageIncompatible):
+		log.Info().Err(err).Int64("chat", chatID).Int("message", id).Msg("can not edit telegram message, resending")
+		return s.resend(ctx, chatID, id, target, caption, stream)
+	case err != nil:
+		return "", fmt.Errorf("error editing telegram message: %w", err)
+	default:
+		log.Debug().Interface("Message", *message).Msg("Sent message.")
+
+		if message.Chat.ID != chatID {
+			return "", errors.New("returned invalid chat id")
+		}
+	}
+
+	tracked.target = target
+	tracked.stream = stream
+	s.live.update(key, tracked)
+
+	return messageID, nil
+}
+
+// resend sends a new message replacing a previous one, which is deleted unless already gone. The pin of a live
+// stream is moved to the new message.
+func (s *Sender) resend(ctx context.Context,
+	chatID int64,
+	messageID int,
+	target string,
+	caption string,
+	stream domain.StreamInfo) (string, error) {
+	_, topic, err := parseTarget(target)
+	if err != nil {
+		return "", err
+	}
+
+	threadID, err := s.threadID(ctx, chatID, topic, stream)
+	if err != nil {
+		return "", err
+	}
+
+	message, err := s.send(ctx, chatID, threadID, target, caption, stream)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debug().Int64("chat", chatID).Int("old", messageID).Int("new", message.ID).Msg("resent telegram message")
+
+	s.live.remove(liveKey{chatID: chatID, messageID: messageID})
+	s.live.update(liveKey{chatID: chatID, messageID: message.ID}, liveMessage{
+		target:    target,
+		stream:    stream,
+		photo:     stream.ThumbnailURL != "",
+		refreshed: time.Now(),
+	})
+
+	if s.pins.forget(chatID, messageID) && stream.IsOnline {
+		s.pin(ctx, chatID, message.ID)
+	}
+
+	_, err = request(ctx, s, chatID, "", s.b.DeleteMessage,
+		&bot.DeleteMessageParams{ChatID: chatID, MessageID: messageID})
+	err = classifyError(err)
+	if err != nil && !errors.Is(err, ErrMessageGone) {
+		log.Warn().Err(err).Int64("chat", chatID).Int("message", messageID).
+			Msg("failed to delete replaced telegram message")
+	}
+
+	return strconv.Itoa(message.ID), nil
+}
+
+// DeleteStreamInfo deletes a previously sent message, which also removes its pin.
+func (s *Sender) DeleteStreamInfo(ctx context.Context, target string, messageID string) error {
+	chatID, _, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
+	}
+
+	s.pins.forget(chatID, id)
+	s.live.remove(liveKey{chatID: chatID, messageID: id})
+
+	_, err = request(ctx, s, chatID, "", s.b.DeleteMessage, &bot.DeleteMessageParams{
+		ChatID:    chatID,
+		MessageID: id,
+	})
+	err = classifyError(err)
+	if errors.Is(err, ErrMessageGone) {
+		log.Debug().Int64("chat", chatID).Int("message", id).Msg("telegram message already deleted")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting telegram message: %w", err)
+	}
+
+	return nil
+}
+
+// StreamEnded unpins a message and stops refreshing its thumbnail, the message itself is left unchanged.
+func (s *Sender) StreamEnded(ctx context.Context, target string, messageID string) error {
+	chatID, _, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
+	}
+
+	s.unpin(ctx, chatID, id)
+	s.live.remove(liveKey{chatID: chatID, messageID: id})
+
+	return nil
+}
+
+// ReplyStreamInfo sends a text message from a domain.StreamInfo as reply to a previously sent message, unpinning it
+// once the stream is offline.
+func (s *Sender) ReplyStreamInfo(ctx context.Context,
+	target string,
+	messageID string,
+	stream domain.StreamInfo) (string, error) {
+	chatID, topic, err := parseTarget(target)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return "", fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
+	}
+
+	if !stream.IsOnline {
+		defer s.unpin(ctx, chatID, id)
+	}
+
+	caption, err := s.caption(target, stream)
+	if err != nil {
+		return "", err
+	}
+
+	threadID, err := s.threadID(ctx, chatID, topic, stream)
+	if err != nil {
+		return "", err
+	}
+
+	message, err := request(ctx, s, chatID, "", s.b.SendMessage, &bot.SendMessageParams{
+		ChatID:          chatID,
+		MessageThreadID: threadID,
+		Text:            caption,
+		ParseMode:       s.parseMode,
+		ReplyParameters: &models.ReplyParameters{
+			MessageID:                id,
+			AllowSendingWithoutReply: true,
+		},
+		ReplyMarkup: s.keyboard(target, stream),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error replying to telegram message: %w", err)
+	}
+
+	log.Debug().Interface("Message", message).Msg("Sent reply.")
+
+	return strconv.Itoa(message.ID), nil
+}
+
+// SendDigest sends a digest as text message. Targets with automatic forum topics receive it in the general topic.
+func (s *Sender) SendDigest(ctx context.Context, target string, digest domain.Digest) error {
+	chatID, topic, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	threadID := 0
+	if topic != "" && topic != TopicAuto {
+		threadID, err = strconv.Atoi(topic)
 		if err != nil {
-			return fmt.Errorf("error editing telegram photo: %w", err)
+			return err
 		}
 	}
 
-	log.Debug().Interface("Message", *message).Msg("Sent message.")
+	text, err := s.renderer.RenderDigest(chatTarget(target), digest, s.escape)
+	if err != nil {
+		return fmt.Errorf("error rendering telegram digest: %w", err)
+	}
 
-	if message.Chat.ID != chatID {
-		return errors.New("returned invalid chat id")
+	_, err = request(ctx, s, chatID, "", s.b.SendMessage, &bot.SendMessageParams{
+		ChatID:          chatID,
+		MessageThreadID: threadID,
+		Text:            text,
+		ParseMode:       s.parseMode,
+	})
+	if err != nil {
+		return fmt.Errorf("error sending telegram digest: %w", err)
 	}
 
 	return nil
 }
+
+// CheckHealth checks the bot token with getMe.
+func (s *Sender) CheckHealth(ctx context.Context) error {
+	_, err := s.b.GetMe(ctx)
+	if err != nil {
+		return fmt.Errorf("error calling telegram getMe: %w", err)
+	}
+	return nil
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindTelegram
+}
+
+// caption renders the message text of a stream with the template configured for the chat.
+func (s *Sender) caption(target string, stream domain.StreamInfo) (string, error) {
+	caption, err := s.renderer.Render(chatTarget(target), stream, s.escape)
+	if err != nil {
+		return "", fmt.Errorf("error rendering telegram message: %w", err)
+	}
+	return caption, nil
+}
+
+// keyboard builds the inline buttons of a message. Edits replace the keyboard, so it has to be sent with every
+// update. Once a stream is offline, the watch button links the VOD if available. The second button links the page
+// configured for the stream, or the VOD while live.
+func (s *Sender) keyboard(target string, stream domain.StreamInfo) models.ReplyMarkup {
+	if !s.config.Buttons {
+		return nil
+	}
+
+	chat := chatTarget(target)
+	row := make([]models.InlineKeyboardButton, 0, 2)
+
+	watch := models.InlineKeyboardButton{
+		Text: s.renderer.Translate(chat, "watch_stream"),
+		URL:  stream.URL,
+	}
+	if !stream.IsOnline && stream.VODURL != "" {
+		watch = models.InlineKeyboardButton{
+			Text: s.renderer.Translate(chat, "watch_vod"),
+			URL:  stream.VODURL,
+		}
+	}
+	if watch.URL != "" {
+		row = append(row, watch)
+	}
+
+	var link Link
+	if stream.Query != nil {
+		link = s.config.Links[*stream.Query]
+	}
+	switch {
+	case link.URL != "":
+		text := link.Text
+		if text == "" {
+			text = s.renderer.Translate(chat, "open_link")
+		}
+		row = append(row, models.InlineKeyboardButton{Text: text, URL: link.URL})
+	case stream.IsOnline && stream.VODURL != "":
+		row = append(row, models.InlineKeyboardButton{
+			Text: s.renderer.Translate(chat, "watch_vod"),
+			URL:  stream.VODURL,
+		})
+	}
+
+	if len(row) == 0 {
+		return nil
+	}
+
+	return &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{row},
+	}
+}
+
+func chatTarget(target string) domain.Target {
+	return domain.Target{Kind: domain.NotifierKindTelegram, ID: target}
+}
+
+func parseChatID(target string) (int64, error) {
+	chatID, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid telegram chat id %q: %w", target, err)
+	}
+	return chatID, nil
+}
@@ -0,0 +1,169 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// TopicAuto creates a forum topic per streamer on the first notification.
+	TopicAuto = "auto"
+
+	DefaultTopicsFile = "topics.json"
+)
+
+// topicStore persists the forum topics created per streamer, keyed by chat ID and stream.
+type topicStore struct {
+	path string
+
+	mu     sync.Mutex
+	topics map[string]map[string]int
+}
+
+func newTopicStore(path string) (*topicStore, error) {
+	ts := &topicStore{path: path, topics: make(map[string]map[string]int)}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading telegram topics: %w", err)
+	}
+
+	err = json.Unmarshal(b, &ts.topics)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding telegram topics %s: %w", path, err)
+	}
+
+	return ts, nil
+}
+
+func (ts *topicStore) get(chatID int64, stream string) (int, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	id, ok := ts.topics[strconv.FormatInt(chatID, 10)][stream]
+	return id, ok
+}
+
+func (ts *topicStore) set(chatID int64, stream string, threadID int) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	chat := strconv.FormatInt(chatID, 10)
+	if ts.topics[chat] == nil {
+		ts.topics[chat] = make(map[string]int)
+	}
+	if threadID == 0 {
+		delete(ts.topics[chat], stream)
+	} else {
+		ts.topics[chat][stream] = threadID
+	}
+
+	b, err := json.MarshalIndent(ts.topics, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding telegram topics: %w", err)
+	}
+
+	// write to a temporary file first, a crash must not leave a truncated file behind
+	tmp := ts.path + ".tmp"
+	err = os.WriteFile(tmp, b, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing telegram topics: %w", err)
+	}
+	err = os.Rename(tmp, ts.path)
+	if err != nil {
+		return fmt.Errorf("error writing telegram topics: %w", err)
+	}
+
+	return nil
+}
+
+// parseTarget splits a "chatID" or "chatID/topic" target, the topic is a message thread ID or TopicAuto.
+func parseTarget(target string) (int64, string, error) {
+	chat, topic, _ := strings.Cut(target, "/")
+
+	chatID, err := parseChatID(chat)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if topic != "" && topic != TopicAuto {
+		_, err = strconv.Atoi(topic)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid telegram topic %q: %w", topic, err)
+		}
+	}
+
+	return chatID, topic, nil
+}
+
+// threadID resolves the topic of a target to a message thread ID, creating the topic of a streamer if necessary.
+func (s *Sender) threadID(ctx context.Context, chatID int64, topic string, stream domain.StreamInfo) (int, error) {
+	if topic == "" {
+		return 0, nil
+	}
+	if topic != TopicAuto {
+		return strconv.Atoi(topic)
+	}
+	if stream.Query == nil {
+		return 0, errors.New("stream has no query")
+	}
+
+	key := streamKey(stream.Query)
+	if id, ok := s.topics.get(chatID, key); ok {
+		return id, nil
+	}
+
+	created, err := request(ctx, s, chatID, "", s.b.CreateForumTopic, &bot.CreateForumTopicParams{
+		ChatID: chatID,
+		Name:   stream.Username,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error creating telegram forum topic: %w", err)
+	}
+
+	log.Info().Int64("chat", chatID).Str("stream", key).Int("thread", created.MessageThreadID).
+		Msg("created telegram forum topic")
+
+	err = s.topics.set(chatID, key, created.MessageThreadID)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to persist telegram forum topic")
+	}
+
+	return created.MessageThreadID, nil
+}
+
+// forgetTopic drops a created topic that no longer exists, it is recreated on the next notification.
+func (s *Sender) forgetTopic(chatID int64, topic string, stream domain.StreamInfo) bool {
+	if topic != TopicAuto || stream.Query == nil {
+		return false
+	}
+
+	err := s.topics.set(chatID, streamKey(stream.Query), 0)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to persist telegram forum topic")
+	}
+
+	return true
+}
+
+func streamKey(query *domain.StreamQuery) string {
+	key := string(query.Kind) + "/" + query.UserID
+	if query.BaseURL != "" {
+		key += "@" + query.BaseURL
+	}
+	return key
+}
@@ -23,32 +23,55 @@ const (
 	heightPlaceholder = "{height}"
 	twitchTokenURL    = "https://id.twitch.tv/oauth2/token" // #nosec:G101: no credentials
 	twitchStreamsURL  = "https://api.twitch.tv/helix/streams"
+	twitchUsersURL    = "https://api.twitch.tv/helix/users"
 	twitchBaseURL     = "https://twitch.tv"
 	twitchMimeType    = "application/json"
 )
 
 type StreamInfoProvider struct {
+	// Metrics optionally records the HTTP responses and token refreshes of the twitch API.
+	Metrics port.Metrics
+
+	// mu guards the token, which is checked by the readiness probe while polling
+	mu    sync.Mutex
 	token authToken
 }
 
 var _ = (*port.StreamInfoProvider)(nil)
+var _ port.HealthChecker = (*StreamInfoProvider)(nil)
+var _ port.StreamValidator = (*StreamInfoProvider)(nil)
 
 type twitchResponse struct {
 	Data []struct {
-		Username     string `json:"user_login"`
-		GameName     string `json:"game_name"`
-		Title        string `json:"title"`
-		ViewerCount  int    `json:"viewer_count"`
-		ThumbnailURL string `json:"thumbnail_url"`
+		Username     string    `json:"user_login"`
+		GameName     string    `json:"game_name"`
+		Title        string    `json:"title"`
+		ViewerCount  int       `json:"viewer_count"`
+		ThumbnailURL string    `json:"thumbnail_url"`
+		StartedAt    time.Time `json:"started_at"`
 	} `json:"data,omitempty"`
 }
 
+type twitchUsersResponse struct {
+	Data []struct {
+		Login string `json:"login"`
+	} `json:"data"`
+}
+
 type authToken struct {
 	AccessToken   string `json:"access_token"`
 	ExpiresIn     int    `json:"expires_in"`
 	tokenCreation time.Time
 }
 
+func (t authToken) expiry() time.Time {
+	return t.tokenCreation.Add(time.Second * time.Duration(t.ExpiresIn))
+}
+
+func (t authToken) valid() bool {
+	return time.Now().Before(t.expiry())
+}
+
 func formatTwitchPhotoURL(url string) string {
 	url = strings.Replace(url, heightPlaceholder, "1080", 1)
 	return strings.Replace(url, widthPlaceholder, "1920", 1)
@@ -63,13 +86,13 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 
 	log.Info().Int("count", len(streams)).Msg("getting info for twitch streams")
 
-	err := s.authenticate(ctx)
+	token, err := s.authenticate(ctx)
 	if err != nil {
 		errCh <- fmt.Errorf("error authenticating with twitch: %w", err)
 		return
 	}
 
-	bearer := "Bearer " + s.token.AccessToken
+	bearer := "Bearer " + token
 
 	base, err := url.Parse(twitchStreamsURL)
 	if err != nil {
@@ -103,6 +126,7 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 		errCh <- fmt.Errorf("error making request to twitch: %w", err)
 		return
 	}
+	s.observeResponse(resp.StatusCode)
 	if resp.StatusCode != http.StatusOK {
 		errCh <- fmt.Errorf("unexpected response from twitch: %d", resp.StatusCode)
 		return
@@ -142,10 +166,13 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 					Query:        s,
 					Username:     data.Username,
 					Title:        fmt.Sprintf("%s: %s", data.GameName, data.Title),
+					Category:     data.GameName,
 					URL:          fmt.Sprintf("%s/%s", twitchBaseURL, data.Username),
+					VODURL:       fmt.Sprintf("%s/%s/videos", twitchBaseURL, data.Username),
 					ViewerCount:  data.ViewerCount,
 					ThumbnailURL: formatTwitchPhotoURL(data.ThumbnailURL),
 					IsOnline:     true,
+					StartedAt:    data.StartedAt,
 				}
 				online = true
 			}
@@ -163,17 +190,94 @@ func (s *StreamInfoProvider) GetStreamInfos(ctx context.Context,
 	infos <- streamInfos
 }
 
-func (s *StreamInfoProvider) authenticate(ctx context.Context) error {
+// ValidateStream looks up the user of a stream, since unknown users are reported as offline streams.
+func (s *StreamInfoProvider) ValidateStream(ctx context.Context, query domain.StreamQuery) error {
+	token, err := s.authenticate(ctx)
+	if err != nil {
+		return fmt.Errorf("error authenticating with twitch: %w", err)
+	}
+
+	base, err := url.Parse(twitchUsersURL)
+	if err != nil {
+		return err
+	}
+	base.RawQuery = url.Values{"login": {query.UserID}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.String(), nil)
+	if err != nil {
+		return fmt.Errorf("error building request for twitch: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Add("Accept", twitchMimeType)
+	req.Header.Add("Client-Id", viper.GetString("twitch.client_id"))
+
+	client := &http.Client{}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request to twitch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	s.observeResponse(resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		// malformed logins are rejected by the API
+		return fmt.Errorf("%w: invalid twitch username %q", domain.ErrInvalid, query.UserID)
+	default:
+		return fmt.Errorf("unexpected response from twitch: %d", resp.StatusCode)
+	}
+
+	var response twitchUsersResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("error decoding response from twitch: %w", err)
+	}
+
+	for _, user := range response.Data {
+		if strings.EqualFold(user.Login, query.UserID) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: twitch user %q does not exist", domain.ErrInvalid, query.UserID)
+}
+
+// authenticate returns a valid access token, refreshing it if expired.
+func (s *StreamInfoProvider) authenticate(ctx context.Context) (string, error) {
 	log.Debug().Msg("authenticating with twitch API")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.token.AccessToken != "" {
 		log.Debug().Msg("twitch auth token present, checking validity")
-		expiryTime := s.token.tokenCreation.Add(time.Second * time.Duration(s.token.ExpiresIn))
-		if time.Now().Before(expiryTime) {
+		if s.token.valid() {
 			log.Debug().Msg("token still valid.")
-			return nil
+			return s.token.AccessToken, nil
 		}
 	}
 
+	err := s.refreshToken(ctx)
+	if s.Metrics != nil {
+		s.Metrics.ObserveTokenRefresh(s.Kind(), err)
+	}
+	return s.token.AccessToken, err
+}
+
+// CheckHealth checks that a valid access token is available, requesting one if there is none yet or it expired.
+func (s *StreamInfoProvider) CheckHealth(ctx context.Context) error {
+	_, err := s.authenticate(ctx)
+	if err != nil {
+		return fmt.Errorf("error authenticating with twitch: %w", err)
+	}
+	return nil
+}
+
+// refreshToken requests a new app access token with the client credentials.
+func (s *StreamInfoProvider) refreshToken(ctx context.Context) error {
 	base, err := url.Parse(twitchTokenURL)
 	if err != nil {
 		return err
@@ -196,6 +300,7 @@ func (s *StreamInfoProvider) authenticate(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("error executing twitch auth request: %w", err)
 	}
+	s.observeResponse(resp.StatusCode)
 
 	defer resp.Body.Close()
 
@@ -212,3 +317,10 @@ func (s *StreamInfoProvider) authenticate(ctx context.Context) error {
 func (s *StreamInfoProvider) Kind() domain.StreamKind {
 	return domain.StreamKindTwitch
 }
+
+// observeResponse records the status code of a response if metrics are set.
+func (s *StreamInfoProvider) observeResponse(status int) {
+	if s.Metrics != nil {
+		s.Metrics.ObserveHTTPResponse(s.Kind(), status)
+	}
+}
@@ -0,0 +1,332 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EventLive    = "live"
+	EventUpdate  = "update"
+	EventOffline = "offline"
+
+	signatureHeader = "X-Streamobserver-Signature"
+	timestampHeader = "X-Streamobserver-Timestamp"
+	eventHeader     = "X-Streamobserver-Event"
+	contentType     = "application/json"
+
+	DefaultRetries = 3
+	DefaultBackoff = 2 * time.Second
+
+	maxBodyLength = 1 << 20
+)
+
+// defaultTemplate renders the complete event as JSON, used for every event without a custom template.
+const defaultTemplate = `{
+  "event": {{ json .Event }},
+  "target": {{ json .Target }},
+  "message_id": {{ json .MessageID }},
+  "timestamp": {{ json .Timestamp }},
+  "stream": {
+    "kind": {{ json .Stream.Query.Kind }},
+    "id": {{ json .Stream.Query.UserID }},
+    "username": {{ json .Stream.Username }},
+    "title": {{ json .Stream.Title }},
+    "category": {{ json .Stream.Category }},
+    "url": {{ json .Stream.URL }},
+    "viewer_count": {{ .Stream.ViewerCount }},
+    "thumbnail_url": {{ json .Stream.ThumbnailURL }},
+    "online": {{ .Stream.IsOnline }}
+  },
+  "session": {{ with .Stream.Session }}{
+    "started_at": {{ json .StartedAt }},
+    "ended_at": {{ if .Live }}null{{ else }}{{ json .EndedAt }}{{ end }},
+    "duration_seconds": {{ printf "%.0f" .Duration.Seconds }},
+    "peak_viewers": {{ .PeakViewers }},
+    "average_viewers": {{ .AverageViewers }}
+  }{{ else }}null{{ end }}
+}`
+
+// Config holds the settings of a webhook endpoint.
+type Config struct {
+	// URL is the endpoint receiving the rendered payloads.
+	URL string
+	// Headers are added to every request, e.g. for authorization.
+	Headers map[string]string
+	// Secret enables HMAC-SHA256 signing of the payload when set.
+	Secret string
+	// IDField is the top level JSON key of the response holding the message ID, a local ID is generated if missing.
+	IDField string
+	// Templates maps an event (live, update, offline) to a text/template rendering the JSON body.
+	Templates map[string]string
+	// Retries is the number of additional attempts for failed deliveries.
+	Retries int
+	// Backoff is the delay before the first retry, doubled on every further attempt.
+	Backoff time.Duration
+}
+
+// Sender delivers notifications to named webhook endpoints, the target of a notification is the case-insensitive
+// endpoint name.
+type Sender struct {
+	endpoints map[string]*endpoint
+	client    *http.Client
+	lastID    atomic.Int64
+}
+
+var _ port.Notifier = (*Sender)(nil)
+
+type endpoint struct {
+	config    Config
+	templates map[string]*template.Template
+}
+
+// payload is the data passed to the templates.
+type payload struct {
+	Event     string
+	Target    string
+	MessageID string
+	Timestamp string
+	Stream    domain.StreamInfo
+}
+
+// NewWebhookSender validates the config of every endpoint and parses the payload templates.
+func NewWebhookSender(configs map[string]Config) (*Sender, error) {
+	s := &Sender{
+		endpoints: make(map[string]*endpoint),
+		client:    &http.Client{},
+	}
+
+	for name, config := range configs {
+		e, err := newEndpoint(config)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring webhook %s: %w", name, err)
+		}
+		s.endpoints[strings.ToLower(name)] = e
+	}
+
+	s.lastID.Store(time.Now().Unix())
+
+	return s, nil
+}
+
+func newEndpoint(config Config) (*endpoint, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook url is not set")
+	}
+	if config.Retries < 0 {
+		config.Retries = 0
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultBackoff
+	}
+
+	e := &endpoint{
+		config:    config,
+		templates: make(map[string]*template.Template),
+	}
+
+	for _, event := range []string{EventLive, EventUpdate, EventOffline} {
+		text, ok := config.Templates[event]
+		if !ok || text == "" {
+			text = defaultTemplate
+		}
+
+		tmpl, err := template.New(event).Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template for event %s: %w", event, err)
+		}
+		e.templates[event] = tmpl
+	}
+
+	return e, nil
+}
+
+// SendStreamInfo posts the live event of a domain.StreamInfo to the webhook.
+func (s *Sender) SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (string, error) {
+	e, ok := s.endpoints[strings.ToLower(target)]
+	if !ok {
+		return "", fmt.Errorf("unknown webhook %q", target)
+	}
+
+	response, err := s.deliver(ctx, e, EventLive, payload{
+		Event:  EventLive,
+		Target: target,
+		Stream: stream,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if id, ok := extractID(e.config.IDField, response); ok {
+		return id, nil
+	}
+
+	return strconv.FormatInt(s.lastID.Add(1), 10), nil
+}
+
+// UpdateStreamInfo posts an update or offline event of a domain.StreamInfo to the webhook.
+func (s *Sender) UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error {
+	e, ok := s.endpoints[strings.ToLower(target)]
+	if !ok {
+		return fmt.Errorf("unknown webhook %q", target)
+	}
+
+	event := EventUpdate
+	if !stream.IsOnline {
+		event = EventOffline
+	}
+
+	_, err := s.deliver(ctx, e, event, payload{
+		Event:     event,
+		Target:    target,
+		MessageID: messageID,
+		Stream:    stream,
+	})
+
+	return err
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindWebhook
+}
+
+// deliver renders the template of an event and posts it, retrying with exponential backoff.
+func (s *Sender) deliver(ctx context.Context, e *endpoint, event string, data payload) ([]byte, error) {
+	if data.Stream.Query == nil {
+		data.Stream.Query = &domain.StreamQuery{}
+	}
+	data.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
+	body := new(bytes.Buffer)
+	err := e.templates[event].Execute(body, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering webhook template for event %s: %w", event, err)
+	}
+
+	if !json.Valid(body.Bytes()) {
+		return nil, fmt.Errorf("webhook template for event %s rendered invalid json", event)
+	}
+
+	backoff := e.config.Backoff
+	for attempt := 0; ; attempt++ {
+		response, retry, err := s.post(ctx, e.config, event, body.Bytes())
+		if err == nil {
+			return response, nil
+		}
+		if !retry || attempt >= e.config.Retries {
+			return nil, fmt.Errorf("error delivering webhook after %d attempts: %w", attempt+1, err)
+		}
+
+		log.Warn().Err(err).Str("event", event).Dur("backoff", backoff).Msg("webhook delivery failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error delivering webhook: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single request, reporting whether a failure is worth retrying.
+func (s *Sender) post(ctx context.Context, config Config, event string, body []byte) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("error building webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(eventHeader, event)
+	for k, v := range config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, "sha256="+sign(config.Secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("error making webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyLength))
+	if err != nil {
+		return nil, true, fmt.Errorf("error reading webhook response: %w", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return nil, retry, fmt.Errorf("unexpected response from webhook: %d", resp.StatusCode)
+	}
+
+	return response, false, nil
+}
+
+// extractID reads a string or numeric message ID from a top level field of the response.
+func extractID(field string, response []byte) (string, bool) {
+	if field == "" || len(response) == 0 {
+		return "", false
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(response, &fields)
+	if err != nil {
+		log.Debug().Err(err).Msg("webhook response is not a json object, generating message id")
+		return "", false
+	}
+
+	raw, ok := fields[field]
+	if !ok {
+		return "", false
+	}
+
+	var id string
+	if json.Unmarshal(raw, &id) == nil && id != "" {
+		return id, true
+	}
+
+	var number json.Number
+	if json.Unmarshal(raw, &number) == nil {
+		return number.String(), true
+	}
+
+	log.Debug().Str("field", field).Msg("webhook response id is not a string or number, generating message id")
+	return "", false
+}
+
+// sign computes the hex encoded HMAC-SHA256 of the timestamp and body, joined by a dot.
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("error encoding template value: %w", err)
+	}
+	return string(b), nil
+}
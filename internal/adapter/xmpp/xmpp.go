@@ -0,0 +1,422 @@
+package xmpp
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"streamobserver/internal/adapter/relay"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultLiveFormat    = "🔴 {{ .Username }} is live: {{ .Title }} {{ .URL }}"
+	DefaultOfflineFormat = "❌ {{ .Username }} is offline"
+
+	nsClient   = "jabber:client"
+	nsStream   = "http://etherx.jabber.org/streams"
+	nsTLS      = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsSASL     = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsBind     = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsMUC      = "http://jabber.org/protocol/muc"
+	nsPing     = "urn:xmpp:ping"
+	saslPlain  = "PLAIN"
+	clientPort = "5222"
+	tlsPort    = "5223"
+
+	dialTimeout = 30 * time.Second
+	keepalive   = time.Minute
+	readTimeout = 5 * time.Minute
+)
+
+// Config holds the settings of the XMPP connection, the target of a notification is a MUC room JID.
+type Config struct {
+	// JID is the bare or full JID of the bot account.
+	JID string
+	// Password of the bot account, authenticated with SASL PLAIN over TLS.
+	Password string
+	// Server is the host:port to connect to, defaults to the domain of the JID on port 5222, or 5223 with DirectTLS.
+	Server string
+	// DirectTLS connects with TLS instead of STARTTLS.
+	DirectTLS bool
+	// Nick is the nickname used in rooms.
+	Nick string
+	// Rooms are joined on connect, rooms used as targets are joined on demand.
+	Rooms []string
+	// LiveFormat and OfflineFormat are text/templates rendering a domain.StreamInfo as a single line.
+	LiveFormat    string
+	OfflineFormat string
+}
+
+// Sender keeps a long-lived connection to an XMPP server, reconnecting automatically. Updates are only announced
+// when the online state of a stream changes.
+type Sender struct {
+	*relay.Relay
+
+	config Config
+	user   string
+	host   string
+}
+
+var _ port.Notifier = (*Sender)(nil)
+var _ port.StreamEndListener = (*Sender)(nil)
+
+type features struct {
+	StartTLS   *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms []string  `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms>mechanism"`
+	Bind       *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+// stanza is a generic top level element of the stream.
+type stanza struct {
+	XMLName xml.Name
+	ID      string `xml:"id,attr"`
+	Type    string `xml:"type,attr"`
+	From    string `xml:"from,attr"`
+	To      string `xml:"to,attr"`
+	Inner   []byte `xml:",innerxml"`
+}
+
+func NewXMPPSender(config Config) (*Sender, error) {
+	bare, _, _ := strings.Cut(config.JID, "/")
+	user, host, found := strings.Cut(bare, "@")
+	if !found || user == "" || host == "" {
+		return nil, fmt.Errorf("invalid xmpp jid %q", config.JID)
+	}
+	if config.Password == "" {
+		return nil, errors.New("xmpp password is not set")
+	}
+	if config.Server == "" && config.DirectTLS {
+		config.Server = net.JoinHostPort(host, tlsPort)
+	} else if config.Server == "" {
+		config.Server = net.JoinHostPort(host, clientPort)
+	}
+	if config.Nick == "" {
+		config.Nick = user
+	}
+	if config.LiveFormat == "" {
+		config.LiveFormat = DefaultLiveFormat
+	}
+	if config.OfflineFormat == "" {
+		config.OfflineFormat = DefaultOfflineFormat
+	}
+
+	r, err := relay.New(relay.Config{
+		Name:          "xmpp",
+		Server:        config.Server,
+		LiveFormat:    config.LiveFormat,
+		OfflineFormat: config.OfflineFormat,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sender{Relay: r, config: config, user: user, host: host}
+
+	go s.Run(s.session)
+
+	return s, nil
+}
+
+func (s *Sender) Kind() domain.NotifierKind {
+	return domain.NotifierKindXMPP
+}
+
+// session runs a single connection until it fails. A message that could not be delivered is kept in pending.
+func (s *Sender) session(queue <-chan relay.Message, pending **relay.Message) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer c.conn.Close()
+
+	log.Info().Str("jid", s.config.JID).Msg("connected to xmpp")
+
+	joined := make(map[string]bool)
+	for _, room := range s.config.Rooms {
+		err = c.join(room, s.config.Nick)
+		if err != nil {
+			return err
+		}
+		joined[strings.ToLower(room)] = true
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	readErr := make(chan error, 1)
+	go c.read(readErr, done)
+
+	ping := time.NewTicker(keepalive)
+	defer ping.Stop()
+
+	for {
+		if *pending == nil {
+			select {
+			case err = <-readErr:
+				return err
+			case <-ping.C:
+				err = c.write(" ")
+				if err != nil {
+					return err
+				}
+				continue
+			case m := <-queue:
+				*pending = &m
+			}
+		}
+
+		m := **pending
+		if !joined[strings.ToLower(m.Target)] {
+			err = c.join(m.Target, s.config.Nick)
+			if err != nil {
+				return err
+			}
+			joined[strings.ToLower(m.Target)] = true
+		}
+
+		err = c.write(fmt.Sprintf("<message to='%s' type='groupchat'><body>%s</body></message>",
+			escape(m.Target), escape(m.Text)))
+		if err != nil {
+			return err
+		}
+		*pending = nil
+	}
+}
+
+type client struct {
+	conn    net.Conn
+	decoder *xml.Decoder
+	mu      sync.Mutex
+}
+
+// connect dials the server, negotiates TLS, authenticates and binds a resource.
+func (s *Sender) connect() (*client, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	tlsConfig := &tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}
+
+	var conn net.Conn
+	var err error
+	if s.config.DirectTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.Server, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.config.Server)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to xmpp server: %w", err)
+	}
+
+	c := &client{conn: conn}
+	err = c.negotiate(s, tlsConfig)
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *client) negotiate(s *Sender, tlsConfig *tls.Config) error {
+	err := c.conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err != nil {
+		return fmt.Errorf("error setting xmpp deadline: %w", err)
+	}
+
+	f, err := c.open(s.host)
+	if err != nil {
+		return err
+	}
+
+	if !s.config.DirectTLS {
+		if f.StartTLS == nil {
+			return errors.New("xmpp server does not offer starttls")
+		}
+
+		err = c.write("<starttls xmlns='" + nsTLS + "'/>")
+		if err != nil {
+			return err
+		}
+		var proceed stanza
+		err = c.decoder.Decode(&proceed)
+		if err != nil || proceed.XMLName.Local != "proceed" {
+			return fmt.Errorf("xmpp starttls failed: %s %w", proceed.XMLName.Local, err)
+		}
+
+		tlsConn := tls.Client(c.conn, tlsConfig)
+		err = tlsConn.Handshake()
+		if err != nil {
+			return fmt.Errorf("error during xmpp tls handshake: %w", err)
+		}
+		c.conn = tlsConn
+
+		f, err = c.open(s.host)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !slices.Contains(f.Mechanisms, saslPlain) {
+		return errors.New("xmpp server does not offer sasl plain")
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00" + s.user + "\x00" + s.config.Password))
+	err = c.write("<auth xmlns='" + nsSASL + "' mechanism='" + saslPlain + "'>" + auth + "</auth>")
+	if err != nil {
+		return err
+	}
+	var result stanza
+	err = c.decoder.Decode(&result)
+	if err != nil || result.XMLName.Local != "success" {
+		return fmt.Errorf("xmpp authentication failed: %s %w", result.XMLName.Local, err)
+	}
+
+	f, err = c.open(s.host)
+	if err != nil {
+		return err
+	}
+	if f.Bind == nil {
+		return errors.New("xmpp server does not offer resource binding")
+	}
+
+	_, resource, _ := strings.Cut(s.config.JID, "/")
+	if resource == "" {
+		resource = "streamobserver"
+	}
+	err = c.write("<iq type='set' id='bind'><bind xmlns='" + nsBind + "'><resource>" +
+		escape(resource) + "</resource></bind></iq>")
+	if err != nil {
+		return err
+	}
+	var bind stanza
+	err = c.decoder.Decode(&bind)
+	if err != nil || bind.Type != "result" {
+		return fmt.Errorf("xmpp resource binding failed: %s %w", bind.Type, err)
+	}
+
+	err = c.write("<presence/>")
+	if err != nil {
+		return err
+	}
+
+	err = c.conn.SetDeadline(time.Time{})
+	if err != nil {
+		return fmt.Errorf("error resetting xmpp deadline: %w", err)
+	}
+
+	return nil
+}
+
+// open starts a new stream and reads the stream features.
+func (c *client) open(host string) (features, error) {
+	err := c.write("<?xml version='1.0'?><stream:stream to='" + escape(host) + "' xmlns='" + nsClient +
+		"' xmlns:stream='" + nsStream + "' version='1.0'>")
+	if err != nil {
+		return features{}, err
+	}
+
+	c.decoder = xml.NewDecoder(c.conn)
+	for {
+		token, err := c.decoder.Token()
+		if err != nil {
+			return features{}, fmt.Errorf("error reading xmpp stream: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local == "stream" {
+			continue
+		}
+		if start.Name.Space != nsStream || start.Name.Local != "features" {
+			return features{}, fmt.Errorf("unexpected xmpp element %s", start.Name.Local)
+		}
+
+		var f features
+		err = c.decoder.DecodeElement(&f, &start)
+		if err != nil {
+			return features{}, fmt.Errorf("error decoding xmpp stream features: %w", err)
+		}
+		return f, nil
+	}
+}
+
+func (c *client) join(room string, nick string) error {
+	return c.write("<presence to='" + escape(room+"/"+nick) + "'><x xmlns='" + nsMUC +
+		"'><history maxstanzas='0'/></x></presence>")
+}
+
+// read consumes incoming stanzas, answering pings, until the stream fails or the session is done.
+func (c *client) read(errCh chan<- error, done <-chan struct{}) {
+	for {
+		err := c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if err != nil {
+			errCh <- fmt.Errorf("error setting xmpp read deadline: %w", err)
+			return
+		}
+
+		token, err := c.decoder.Token()
+		if err != nil {
+			select {
+			case errCh <- fmt.Errorf("error reading xmpp stream: %w", err):
+			case <-done:
+			}
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "stream" {
+				errCh <- errors.New("xmpp server closed the stream")
+				return
+			}
+		case xml.StartElement:
+			var st stanza
+			err = c.decoder.DecodeElement(&st, &t)
+			if err != nil {
+				errCh <- fmt.Errorf("error decoding xmpp stanza: %w", err)
+				return
+			}
+			c.handle(st)
+		}
+	}
+}
+
+func (c *client) handle(st stanza) {
+	switch {
+	case st.XMLName.Local == "iq" && st.Type == "get" && strings.Contains(string(st.Inner), nsPing):
+		err := c.write("<iq type='result' id='" + escape(st.ID) + "' to='" + escape(st.From) + "'/>")
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to answer xmpp ping")
+		}
+	case st.XMLName.Local == "presence" && st.Type == "error":
+		log.Warn().Str("from", st.From).Msg("xmpp room presence error, check room address and permissions")
+	case st.XMLName.Local == "message" && st.Type == "error":
+		log.Warn().Str("from", st.From).Msg("xmpp message error")
+	case st.XMLName.Space == nsStream && st.XMLName.Local == "error":
+		log.Warn().Bytes("error", st.Inner).Msg("xmpp stream error")
+	}
+}
+
+func (c *client) write(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.conn.Write([]byte(data))
+	if err != nil {
+		return fmt.Errorf("error writing to xmpp server: %w", err)
+	}
+	return nil
+}
+
+func escape(text string) string {
+	b := new(strings.Builder)
+	_ = xml.EscapeText(b, []byte(text))
+	return b.String()
+}
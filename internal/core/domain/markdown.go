@@ -0,0 +1,15 @@
+package domain
+
+import "strings"
+
+// EscapeMarkdownV2 escapes all characters reserved by the Telegram MarkdownV2 parse mode.
+func EscapeMarkdownV2(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("_*[]()~`>#+-=|{}.!\\", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
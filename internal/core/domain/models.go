@@ -1,5 +1,22 @@
 package domain
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown streams and chats.
+	ErrNotFound = errors.New("not found")
+	// ErrAmbiguous is returned if an identifier matches more than one stream.
+	ErrAmbiguous = errors.New("ambiguous")
+	// ErrInvalid is returned for subscriptions that can not be observed, e.g. without a notifier for their target.
+	ErrInvalid = errors.New("invalid")
+)
+
 type StreamQuery struct {
 	UserID    string
 	BaseURL   string
@@ -22,50 +39,306 @@ const (
 	StreamKindBroadcastBox StreamKind = "broadcastbox"
 )
 
+// StreamErrors is reported by providers for the streams of a poll that failed while the others succeeded.
+type StreamErrors map[StreamQuery]error
+
+func (e StreamErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for query, err := range e {
+		messages = append(messages, fmt.Sprintf("stream %s: %v", query.UserID, err))
+	}
+	slices.Sort(messages)
+	return strings.Join(messages, "; ")
+}
+
 type StreamInfo struct {
-	Query        *StreamQuery
-	Username     string
-	Title        string
-	URL          string
+	Query    *StreamQuery
+	Username string
+	Title    string
+	// Category is the game or category of the stream, empty if the service has none
+	Category string
+	URL      string
+	// VODURL links to the recordings of the stream, empty if the service has none
+	VODURL       string
 	ViewerCount  int
 	ThumbnailURL string
 	IsOnline     bool
+	// StartedAt is the start of the broadcast reported by the service, zero if unknown
+	StartedAt time.Time
+	// Session is the current or, once offline, the last session of the stream, nil if untracked
+	Session *Session
 }
 
 func (s StreamInfo) Equals(o StreamInfo) bool {
 	return s.IsOnline == o.IsOnline &&
 		s.Title == o.Title &&
+		s.Category == o.Category &&
 		s.URL == o.URL &&
 		s.ThumbnailURL == o.ThumbnailURL &&
 		s.ViewerCount == o.ViewerCount
 }
 
+type NotifierKind string
+
+const (
+	NotifierKindTelegram NotifierKind = "telegram"
+	NotifierKindWebhook  NotifierKind = "webhook"
+	NotifierKindNtfy     NotifierKind = "ntfy"
+	NotifierKindGotify   NotifierKind = "gotify"
+	NotifierKindEmail    NotifierKind = "email"
+	NotifierKindSlack    NotifierKind = "slack"
+	NotifierKindMastodon NotifierKind = "mastodon"
+	NotifierKindBluesky  NotifierKind = "bluesky"
+	NotifierKindIRC      NotifierKind = "irc"
+	NotifierKindXMPP     NotifierKind = "xmpp"
+	NotifierKindMQTT     NotifierKind = "mqtt"
+)
+
+// Target addresses a chat, channel or endpoint of a notifier, written as "kind:id" in the config.
+type Target struct {
+	Kind NotifierKind
+	ID   string
+}
+
+// ParseTarget parses a "kind:id" target, a bare ID is treated as a Telegram chat.
+func ParseTarget(s string) (Target, error) {
+	kind, id, found := strings.Cut(s, ":")
+	if !found {
+		kind, id = string(NotifierKindTelegram), s
+	}
+
+	if kind == "" || id == "" {
+		return Target{}, fmt.Errorf("invalid notification target %q, expected kind:id", s)
+	}
+
+	return Target{Kind: NotifierKind(kind), ID: id}, nil
+}
+
+func (t Target) String() string {
+	return string(t.Kind) + ":" + t.ID
+}
+
+// OfflinePolicy is the action taken on the message of an observer when a stream ends.
+type OfflinePolicy string
+
+const (
+	// OfflinePolicyEdit updates the message to the offline status.
+	OfflinePolicyEdit OfflinePolicy = "edit"
+	// OfflinePolicyDelete deletes the message.
+	OfflinePolicyDelete OfflinePolicy = "delete"
+	// OfflinePolicyRepost replies to the message with the offline status.
+	OfflinePolicyRepost OfflinePolicy = "repost"
+	// OfflinePolicyIgnore leaves the message untouched.
+	OfflinePolicyIgnore OfflinePolicy = "ignore"
+)
+
+// ParseOfflinePolicy parses a policy name, an empty name is OfflinePolicyEdit.
+func ParseOfflinePolicy(s string) (OfflinePolicy, error) {
+	switch p := OfflinePolicy(strings.ToLower(s)); p {
+	case "":
+		return OfflinePolicyEdit, nil
+	case OfflinePolicyEdit, OfflinePolicyDelete, OfflinePolicyRepost, OfflinePolicyIgnore:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid offline policy %q, expected edit, delete, repost or ignore", s)
+	}
+}
+
 type Observer struct {
-	ChannelID int64
-	MessageID int
+	Target Target
+	// MessageID is the handle of the last sent message returned by the notifier, empty if none is active
+	MessageID     string
+	OfflinePolicy OfflinePolicy
+	// LastError is the error of the last notification, empty if it succeeded
+	LastError string
+}
+
+// Observes checks whether an observer notifies a chat, Telegram chats also match their forum topics.
+func (o Observer) Observes(chat Target) bool {
+	if o.Target == chat {
+		return true
+	}
+	return chat.Kind == NotifierKindTelegram && o.Target.Kind == chat.Kind &&
+		strings.HasPrefix(o.Target.ID, chat.ID+"/")
 }
 
 type ObservedStream struct {
 	Observers              []Observer
 	LatestInfo             StreamInfo
 	PublishedOfflineStatus bool
+	Session                *Session
+}
+
+// Subscription is a stream observed by a notification target.
+type Subscription struct {
+	Target        Target
+	Query         StreamQuery
+	OfflinePolicy OfflinePolicy
+}
+
+// StreamStatus is the state of an observed stream as seen by the poller.
+type StreamStatus struct {
+	Query      StreamQuery
+	LatestInfo StreamInfo
+	Session    *Session
+	Observers  []Observer
+	// LastPoll is the time of the last poll of the stream, zero if not polled yet
+	LastPoll time.Time
+	// LastError is the error of the last poll of the stream, empty if it succeeded
+	LastError string
+}
+
+// Session is a single broadcast of a stream, from going live until going offline.
+type Session struct {
+	StartedAt time.Time
+	// EndedAt is zero while the stream is live
+	EndedAt     time.Time
+	PeakViewers int
+	// ViewerSum and Samples accumulate the viewer counts of all polls reporting one
+	ViewerSum int64
+	Samples   int
+	// Changes holds the title and category of the session start and of every later change
+	Changes []SessionChange
+}
+
+type SessionChange struct {
+	Time     time.Time
+	Title    string
+	Category string
+}
+
+// Live reports whether the session has not ended yet.
+func (s *Session) Live() bool {
+	return s.EndedAt.IsZero()
+}
+
+// Duration returns the length of the session, up to now while live.
+func (s *Session) Duration() time.Duration {
+	if s.Live() {
+		return time.Since(s.StartedAt)
+	}
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+// AverageViewers returns the mean of the sampled viewer counts, zero if the service reports none.
+func (s *Session) AverageViewers() int {
+	if s.Samples == 0 {
+		return 0
+	}
+	return int(s.ViewerSum / int64(s.Samples))
+}
+
+// Clone returns a copy of the session, safe to pass to notifiers while the session is tracked further.
+func (s *Session) Clone() *Session {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Changes = append([]SessionChange(nil), s.Changes...)
+	return &c
+}
+
+// StreamStats summarizes the recorded sessions of a stream.
+type StreamStats struct {
+	Query          StreamQuery
+	Sessions       int
+	Total          time.Duration
+	Average        time.Duration
+	Longest        time.Duration
+	PeakViewers    int
+	AverageViewers int
+	// Heatmap holds the streamed time per weekday, starting on Sunday, and hour of the day
+	Heatmap [7][24]time.Duration
+}
+
+// Digest summarizes the sessions of the streams observed by a chat over a period.
+type Digest struct {
+	From    time.Time
+	To      time.Time
+	Streams []DigestEntry
+}
+
+// DigestEntry summarizes the sessions of a stream, Sessions is zero if the stream was not live.
+type DigestEntry struct {
+	Query       StreamQuery
+	Username    string
+	Sessions    int
+	Live        time.Duration
+	PeakViewers int
+	// Category is the category streamed the longest, empty if the service has none
+	Category string
+}
+
+type HealthStatus string
+
+const (
+	HealthStatusOK      HealthStatus = "ok"
+	HealthStatusFailing HealthStatus = "failing"
+	// HealthStatusPending is reported by checks without a result yet, e.g. before the first poll
+	HealthStatusPending HealthStatus = "pending"
+)
+
+// HealthCheck is the result of checking a part of the service or one of its dependencies.
+type HealthCheck struct {
+	Name   string
+	Status HealthStatus
+	// Message describes the result, e.g. the error of a failing check
+	Message string
+	// Time is when the checked event happened, e.g. the last poll, zero if unknown
+	Time time.Time
+}
+
+// HealthReport is healthy if all of its checks are.
+type HealthReport struct {
+	Status HealthStatus
+	Checks []HealthCheck
+}
+
+// NewHealthReport derives the status of a report from its checks.
+func NewHealthReport(checks []HealthCheck) HealthReport {
+	report := HealthReport{Status: HealthStatusOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status != HealthStatusOK {
+			report.Status = HealthStatusFailing
+		}
+	}
+	return report
 }
 
 type ChatConfig struct {
-	ChatID  int64 `yaml:"chatid"`
-	Streams struct {
+	ChatID   int64    `yaml:"chatid"`
+	Targets  []string `yaml:"targets"`
+	Template string   `yaml:"template"`
+	Locale   string   `yaml:"locale"`
+	Topic    string   `yaml:"topic"`
+	Pin      string   `yaml:"pin"`
+	Offline  string   `yaml:"offline"`
+	Digest   bool     `yaml:"digest"`
+	Streams  struct {
 		Twitch []struct {
-			Username string `yaml:"username"`
+			Username   string `yaml:"username"`
+			Template   string `yaml:"template"`
+			Topic      string `yaml:"topic"`
+			ButtonURL  string `yaml:"buttonurl"`
+			ButtonText string `yaml:"buttontext"`
 		} `yaml:"twitch"`
 		Restreamer []struct {
-			BaseURL   string `yaml:"baseurl"`
-			ID        string `yaml:"id"`
-			CustomURL string `yaml:"customurl"`
+			BaseURL    string `yaml:"baseurl"`
+			ID         string `yaml:"id"`
+			CustomURL  string `yaml:"customurl"`
+			Template   string `yaml:"template"`
+			Topic      string `yaml:"topic"`
+			ButtonURL  string `yaml:"buttonurl"`
+			ButtonText string `yaml:"buttontext"`
 		} `yaml:"restreamer"`
 		BroadcastBox []struct {
-			BaseURL   string `yaml:"baseurl"`
-			ID        string `yaml:"id"`
-			CustomURL string `yaml:"customurl"`
+			BaseURL    string `yaml:"baseurl"`
+			ID         string `yaml:"id"`
+			CustomURL  string `yaml:"customurl"`
+			Template   string `yaml:"template"`
+			Topic      string `yaml:"topic"`
+			ButtonURL  string `yaml:"buttonurl"`
+			ButtonText string `yaml:"buttontext"`
 		} `yaml:"broadcastbox"`
 	} `yaml:"streams"`
 }
@@ -4,10 +4,13 @@ import (
 	"context"
 	"streamobserver/internal/core/domain"
 	"sync"
+	"time"
 )
 
 type StreamInfoProvider interface {
 	// GetStreamInfos takes an array of streams for a single stream service and returns metadata for those that are online.
+	// Streams that could not be polled are left out of the infos and reported as domain.StreamErrors, an error
+	// failing the whole batch is sent without infos.
 	GetStreamInfos(ctx context.Context,
 		streams []*domain.StreamQuery,
 		wg *sync.WaitGroup,
@@ -17,21 +20,171 @@ type StreamInfoProvider interface {
 	Kind() domain.StreamKind
 }
 
+// StreamValidator is implemented by providers able to check that a stream exists, which can not be told from an
+// offline stream otherwise
+type StreamValidator interface {
+	// ValidateStream returns an error wrapping domain.ErrInvalid if the stream does not exist
+	ValidateStream(ctx context.Context, query domain.StreamQuery) error
+}
+
 type Notifier interface {
-	// SendStreamInfo sends a message with stream info to a target channel ID
-	SendStreamInfo(ctx context.Context, target int64, stream domain.StreamInfo) (messageID int, err error)
-	// UpdateStreamInfo updates a previously sent message ID with stream info
-	UpdateStreamInfo(ctx context.Context, chatID int64, messageID int, stream domain.StreamInfo) error
+	// SendStreamInfo sends a message with stream info to a target and returns a handle to the message
+	SendStreamInfo(ctx context.Context, target string, stream domain.StreamInfo) (messageID string, err error)
+	// UpdateStreamInfo updates a previously sent message handle with stream info
+	UpdateStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) error
+	// Kind returns the notification service targeted by this notifier
+	Kind() domain.NotifierKind
+}
+
+// MessageDeleter is implemented by notifiers able to delete a sent message
+type MessageDeleter interface {
+	// DeleteStreamInfo deletes a previously sent message handle
+	DeleteStreamInfo(ctx context.Context, target string, messageID string) error
+}
+
+// MessageReplier is implemented by notifiers able to reply to a sent message
+type MessageReplier interface {
+	// ReplyStreamInfo sends a message with stream info as reply to a previously sent message handle
+	ReplyStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) (string, error)
+}
+
+// MessageReplacer is implemented by notifiers that may have to replace a message when updating it
+type MessageReplacer interface {
+	// ReplaceStreamInfo updates a previously sent message handle and returns the handle of the updated message,
+	// which differs from the previous one if the message was replaced
+	ReplaceStreamInfo(ctx context.Context, target string, messageID string, stream domain.StreamInfo) (string, error)
+}
+
+// StreamEndListener is implemented by notifiers keeping state per sent message, such as pins or tracked updates
+type StreamEndListener interface {
+	// StreamEnded releases the state of a message handle once its stream ended and the offline policy was applied,
+	// whatever the policy, without changing the message
+	StreamEnded(ctx context.Context, target string, messageID string) error
+}
+
+// DeliveryReporter is implemented by notifiers delivering sent messages in the background after returning their handle
+type DeliveryReporter interface {
+	// OnDeliveryFailed sets the callback reporting a message handle whose background delivery to a target failed
+	OnDeliveryFailed(report func(target string, messageID string, err error))
+}
+
+// DigestSender is implemented by notifiers able to send a digest of the sessions of the observed streams
+type DigestSender interface {
+	// SendDigest sends a digest to a target
+	SendDigest(ctx context.Context, target string, digest domain.Digest) error
+}
+
+type MessageRenderer interface {
+	// Render generates the message text for a stream notified to a target, escaping inserted text if escape is set
+	Render(target domain.Target, stream domain.StreamInfo, escape func(string) string) (string, error)
+	// RenderDigest generates the message text of a digest sent to a target, escaping inserted text if escape is set
+	RenderDigest(target domain.Target, digest domain.Digest, escape func(string) string) (string, error)
+	// Translate returns a message in the locale of a target
+	Translate(target domain.Target, key string) string
 }
 
 type NotificationBroker interface {
-	// Register adds a target channel ID and a stream to observe NotificationBroker
-	Register(target int64, query *domain.StreamQuery)
+	// Register adds a notification target and a stream to observe NotificationBroker
+	Register(target domain.Target, query *domain.StreamQuery, policy domain.OfflinePolicy) error
+	// Unregister removes a notification target from a stream, the stream is no longer polled without targets
+	Unregister(target domain.Target, query domain.StreamQuery) error
 	// StartPolling starts the notification routine
 	StartPolling(ctx context.Context)
 }
 
 type StreamInfoService interface {
-	// GetStreamInfos retrieves stream info for different providers
+	// GetStreamInfos retrieves stream info for different providers, returning the infos of the streams polled
+	// successfully along with an error describing the failed ones
 	GetStreamInfos(ctx context.Context, streams []*domain.StreamQuery) ([]domain.StreamInfo, error)
+	// ProbeStream checks that a stream exists and can be polled without recording the outcome as a poll, an unknown
+	// stream or stream kind is reported as domain.ErrInvalid
+	ProbeStream(ctx context.Context, query domain.StreamQuery) (domain.StreamInfo, error)
+}
+
+type SessionStore interface {
+	// SaveSession creates or updates a session of a stream, identified by its start, adding a viewer sample unless
+	// viewers is negative
+	SaveSession(ctx context.Context, query domain.StreamQuery, session domain.Session, viewers int) error
+	// Sessions returns the sessions of a stream started since a time with their changes, unfinished sessions end at
+	// their last update
+	Sessions(ctx context.Context, query domain.StreamQuery, since time.Time) ([]domain.Session, error)
+	// Streams returns all streams with recorded sessions
+	Streams(ctx context.Context) ([]domain.StreamQuery, error)
+}
+
+type SessionListener interface {
+	// SessionEnded is called with the last info of a stream once its session ended
+	SessionEnded(stream domain.StreamInfo, session domain.Session)
+}
+
+type StatsReporter interface {
+	// Report generates a text report of the sessions of a stream given as "kind/id" or a unique id
+	Report(ctx context.Context, stream string, since time.Time) (string, error)
+	// Streams returns the names of all streams with recorded sessions
+	Streams(ctx context.Context) ([]string, error)
+}
+
+type Metrics interface {
+	// ObservePoll records the duration and outcome of polling the streams of a provider
+	ObservePoll(kind domain.StreamKind, duration time.Duration, err error)
+	// ObserveHTTPResponse records the status code of a response of a streaming service
+	ObserveHTTPResponse(kind domain.StreamKind, status int)
+	// ObserveTokenRefresh records a refresh of the access token of a streaming service
+	ObserveTokenRefresh(kind domain.StreamKind, err error)
+	// SetObserved sets the number of observed streams and of their observers
+	SetObserved(streams int, observers int)
+	// ObserveStreams records the live status and viewers of polled streams
+	ObserveStreams(infos []domain.StreamInfo)
+	// ObserveNotification records the outcome of a notifier operation: send, deliver, edit, delete or reply
+	ObserveNotification(kind domain.NotifierKind, operation string, err error)
+}
+
+// ClassifiedError is implemented by errors reporting a class for metrics, e.g. "rate_limited"
+type ClassifiedError interface {
+	error
+	ErrorClass() string
+}
+
+// HealthChecker is implemented by adapters able to verify that their dependency is usable, e.g. its credentials
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+type HealthReporter interface {
+	// Liveness reports whether the process and the poll loop are alive
+	Liveness(ctx context.Context) domain.HealthReport
+	// Readiness reports whether all dependencies are usable and the last poll of every provider succeeded
+	Readiness(ctx context.Context) domain.HealthReport
+}
+
+type ChangeListener interface {
+	// StreamsChanged is called after every poll and whenever streams or their observers changed, it must not block
+	StreamsChanged()
+}
+
+type StatusReporter interface {
+	// Streams returns the state of all observed streams
+	Streams(ctx context.Context) []domain.StreamStatus
+	// Stream returns the state of a stream, the base URL is only needed if the ID is ambiguous
+	Stream(ctx context.Context, kind domain.StreamKind, id string, baseURL string) (domain.StreamStatus, error)
+	// Chat returns the streams observed by a chat, with only the observers of the chat
+	Chat(ctx context.Context, chat domain.Target) ([]domain.StreamStatus, error)
+}
+
+type SubscriptionStore interface {
+	// Seed stores the subscriptions unless the store was seeded before, reporting whether it did
+	Seed(ctx context.Context, subscriptions []domain.Subscription) (bool, error)
+	// Subscriptions returns all stored subscriptions in the order they were added
+	Subscriptions(ctx context.Context) ([]domain.Subscription, error)
+	// AddSubscription stores a subscription, updating the offline policy of an existing one
+	AddSubscription(ctx context.Context, subscription domain.Subscription) error
+	// RemoveSubscription deletes a subscription, domain.ErrNotFound if it is not stored
+	RemoveSubscription(ctx context.Context, target domain.Target, query domain.StreamQuery) error
+}
+
+type SubscriptionManager interface {
+	// Subscribe probes the stream of a subscription once, then observes and stores it
+	Subscribe(ctx context.Context, subscription domain.Subscription) error
+	// Unsubscribe stops observing a stream for a target and removes the subscription from the store
+	Unsubscribe(ctx context.Context, target domain.Target, query domain.StreamQuery) error
 }
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// digestPeriod is the time span covered by a digest.
+	digestPeriod = 7 * 24 * time.Hour
+	// digestRetention is how long ended sessions are kept for the digests.
+	digestRetention = 2 * digestPeriod
+	digestTimeout   = time.Minute
+)
+
+// DigestService sends a digest of the last week to the registered chats on a cron schedule, including the sessions
+// still live. The sessions are read from the session store if set, otherwise aggregates of the ended sessions are
+// kept in memory and sessions ended before a restart are lost.
+type DigestService struct {
+	notifications *NotificationService
+	notifiers     map[domain.NotifierKind]port.Notifier
+	cron          *cron.Cron
+	location      *time.Location
+	store         port.SessionStore
+
+	mu       sync.Mutex
+	sessions map[domain.StreamQuery][]sessionAggregate
+	names    map[domain.StreamQuery]string
+	chats    []digestChat
+}
+
+var _ port.SessionListener = (*DigestService)(nil)
+
+type sessionAggregate struct {
+	start       time.Time
+	end         time.Time
+	peakViewers int
+	categories  []categorySpan
+}
+
+// categorySpan is the time a session spent in a category.
+type categorySpan struct {
+	category string
+	start    time.Time
+	end      time.Time
+}
+
+type digestChat struct {
+	targets []domain.Target
+	queries []domain.StreamQuery
+}
+
+// NewDigestService validates a standard five field cron schedule, evaluated in location, time.Local if nil.
+func NewDigestService(notifications *NotificationService,
+	schedule string,
+	location *time.Location,
+	notifiers ...port.Notifier) (*DigestService, error) {
+	if location == nil {
+		location = time.Local
+	}
+
+	d := &DigestService{
+		notifications: notifications,
+		notifiers:     make(map[domain.NotifierKind]port.Notifier),
+		cron:          cron.New(cron.WithLocation(location)),
+		location:      location,
+		sessions:      make(map[domain.StreamQuery][]sessionAggregate),
+		names:         make(map[domain.StreamQuery]string),
+	}
+
+	for _, notifier := range notifiers {
+		d.notifiers[notifier.Kind()] = notifier
+	}
+
+	_, err := d.cron.AddFunc(schedule, d.sendAll)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest schedule %q: %w", schedule, err)
+	}
+
+	return d, nil
+}
+
+// SetSessionStore builds the digests from the recorded sessions instead of the sessions ended since the start.
+func (d *DigestService) SetSessionStore(store port.SessionStore) {
+	d.store = store
+}
+
+// AddChat registers the targets of a chat to receive the digest of its streams. Targets whose notifier can not send
+// digests are left out, a chat without any target able to receive the digest is rejected.
+func (d *DigestService) AddChat(targets []domain.Target, queries []*domain.StreamQuery) error {
+	chat := digestChat{
+		targets: make([]domain.Target, 0, len(targets)),
+		queries: make([]domain.StreamQuery, 0, len(queries)),
+	}
+	for _, target := range targets {
+		if _, ok := d.notifiers[target.Kind].(port.DigestSender); !ok {
+			log.Info().Stringer("target", target).Msg("notifier can not send digests, leaving out target")
+			continue
+		}
+		chat.targets = append(chat.targets, target)
+	}
+	if len(chat.targets) == 0 {
+		return fmt.Errorf("no target of the chat can receive digests: %v", targets)
+	}
+
+	for _, query := range queries {
+		chat.queries = append(chat.queries, *query)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.chats = append(d.chats, chat)
+
+	return nil
+}
+
+// Start runs the schedule in the background.
+func (d *DigestService) Start() {
+	d.cron.Start()
+
+	for _, entry := range d.cron.Entries() {
+		log.Info().Time("next", entry.Next).Msg("scheduled digest")
+	}
+}
+
+// SessionEnded aggregates an ended session, dropping sessions too old for any digest.
+func (d *DigestService) SessionEnded(stream domain.StreamInfo, session domain.Session) {
+	if stream.Query == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	query := *stream.Query
+	if stream.Username != "" {
+		d.names[query] = stream.Username
+	}
+	if d.store != nil {
+		return
+	}
+
+	sessions := make([]sessionAggregate, 0, len(d.sessions[query])+1)
+	for _, s := range d.sessions[query] {
+		if time.Since(s.end) < digestRetention {
+			sessions = append(sessions, s)
+		}
+	}
+	d.sessions[query] = append(sessions, aggregate(session, session.EndedAt))
+}
+
+// aggregate summarizes a session ending at end, the categories last until the next change.
+func aggregate(session domain.Session, end time.Time) sessionAggregate {
+	a := sessionAggregate{
+		start:       session.StartedAt,
+		end:         end,
+		peakViewers: session.PeakViewers,
+		categories:  make([]categorySpan, 0, len(session.Changes)),
+	}
+
+	for i, change := range session.Changes {
+		until := end
+		if i+1 < len(session.Changes) {
+			until = session.Changes[i+1].Time
+		}
+		if change.Category != "" {
+			a.categories = append(a.categories, categorySpan{
+				category: change.Category,
+				start:    change.Time,
+				end:      until,
+			})
+		}
+	}
+
+	return a
+}
+
+// since returns the time live and the time per category of a session after from, the part of a session started
+// before is not counted.
+func (a sessionAggregate) since(from time.Time) (time.Duration, map[string]time.Duration) {
+	categories := make(map[string]time.Duration)
+	for _, span := range a.categories {
+		categories[span.category] += clip(span.start, span.end, from)
+	}
+
+	return clip(a.start, a.end, from), categories
+}
+
+// clip returns the length of a time span after from.
+func clip(start time.Time, end time.Time, from time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	return max(end.Sub(start), 0)
+}
+
+func (d *DigestService) sendAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), digestTimeout)
+	defer cancel()
+
+	d.mu.Lock()
+	chats := append([]digestChat(nil), d.chats...)
+	d.mu.Unlock()
+
+	to := time.Now().In(d.location)
+	from := to.Add(-digestPeriod)
+
+	for _, chat := range chats {
+		digest, err := d.digest(ctx, chat.queries, from, to)
+		if err != nil {
+			log.Err(err).Msg("failed to build digest")
+			continue
+		}
+
+		for _, target := range chat.targets {
+			// targets were checked to be able to receive digests when added
+			sender := d.notifiers[target.Kind].(port.DigestSender)
+			err := sender.SendDigest(ctx, target.ID, digest)
+			if err != nil {
+				log.Err(err).Stringer("target", target).Msg("failed to send digest")
+				continue
+			}
+			log.Info().Stringer("target", target).Msg("sent digest")
+		}
+	}
+}
+
+// digest summarizes the sessions of streams ended within a period and the sessions still live.
+func (d *DigestService) digest(ctx context.Context,
+	queries []domain.StreamQuery,
+	from time.Time,
+	to time.Time) (domain.Digest, error) {
+	live := make(map[domain.StreamQuery]domain.ObservedStream)
+	for query, observed := range d.notifications.observed() {
+		live[*query] = observed
+	}
+
+	digest := domain.Digest{From: from, To: to, Streams: make([]domain.DigestEntry, 0, len(queries))}
+
+	for _, query := range queries {
+		sessions, err := d.ended(ctx, query, from, to)
+		if err != nil {
+			return domain.Digest{}, err
+		}
+
+		d.mu.Lock()
+		entry := domain.DigestEntry{Query: query, Username: d.names[query]}
+		d.mu.Unlock()
+
+		observed := live[query]
+		if observed.Session != nil && observed.Session.Live() {
+			// a session recorded in the store is still live, it is counted up to the end of the period
+			current := observed.Session.StartedAt.Unix()
+			sessions = slices.DeleteFunc(sessions, func(s sessionAggregate) bool {
+				return s.start.Unix() == current
+			})
+			sessions = append(sessions, aggregate(*observed.Session, to))
+		}
+		if entry.Username == "" {
+			entry.Username = observed.LatestInfo.Username
+		}
+		if entry.Username == "" {
+			entry.Username = query.UserID
+		}
+
+		categories := make(map[string]time.Duration)
+		for _, s := range sessions {
+			live, spans := s.since(from)
+			entry.Sessions++
+			entry.Live += live
+			entry.PeakViewers = max(entry.PeakViewers, s.peakViewers)
+			for category, duration := range spans {
+				categories[category] += duration
+			}
+		}
+
+		for category, duration := range categories {
+			if duration > categories[entry.Category] ||
+				duration == categories[entry.Category] && category < entry.Category {
+				entry.Category = category
+			}
+		}
+
+		digest.Streams = append(digest.Streams, entry)
+	}
+
+	// the most active streams first
+	sort.SliceStable(digest.Streams, func(i, j int) bool {
+		return digest.Streams[i].Live > digest.Streams[j].Live
+	})
+
+	return digest, nil
+}
+
+// ended returns the sessions of a stream ended within a period, read from the session store if set. Unfinished
+// sessions of the store end at their last update.
+func (d *DigestService) ended(ctx context.Context,
+	query domain.StreamQuery,
+	from time.Time,
+	to time.Time) ([]sessionAggregate, error) {
+	sessions := make([]sessionAggregate, 0)
+	inPeriod := func(end time.Time) bool {
+		return !end.Before(from) && !end.After(to)
+	}
+
+	if d.store == nil {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		for _, s := range d.sessions[query] {
+			if inPeriod(s.end) {
+				sessions = append(sessions, s)
+			}
+		}
+		return sessions, nil
+	}
+
+	// sessions ending within the period may have started before it
+	recorded, err := d.store.Sessions(ctx, query, from.Add(-digestPeriod))
+	if err != nil {
+		return nil, fmt.Errorf("error reading sessions of %s: %w", query.UserID, err)
+	}
+	for _, session := range recorded {
+		if inPeriod(session.EndedAt) {
+			sessions = append(sessions, aggregate(session, session.EndedAt))
+		}
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"streamobserver/internal/core/domain"
+	"testing"
+	"time"
+)
+
+func TestDigest_ClipsSessionsStartedBeforePeriod(t *testing.T) {
+	d, err := NewDigestService(NewNotificationService(nil), "0 9 * * 1", time.UTC)
+	if err != nil {
+		t.Fatalf("error creating digest service: %v", err)
+	}
+
+	to := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	from := to.Add(-digestPeriod)
+	query := domain.StreamQuery{UserID: "streamer", Kind: domain.StreamKindTwitch}
+
+	// live for four hours, three of them before the period
+	started := from.Add(-3 * time.Hour)
+	d.SessionEnded(domain.StreamInfo{Query: &query, Username: "streamer"}, domain.Session{
+		StartedAt: started,
+		EndedAt:   from.Add(time.Hour),
+		Changes: []domain.SessionChange{
+			{Time: started, Category: "Chess"},
+			{Time: from.Add(-30 * time.Minute), Category: "Art"},
+		},
+	})
+
+	digest, err := d.digest(context.Background(), []domain.StreamQuery{query}, from, to)
+	if err != nil {
+		t.Fatalf("error building digest: %v", err)
+	}
+
+	entry := digest.Streams[0]
+	if entry.Sessions != 1 {
+		t.Errorf("expected one session, got %d", entry.Sessions)
+	}
+	if entry.Live != time.Hour {
+		t.Errorf("expected one hour live, got %s", entry.Live)
+	}
+	if entry.Category != "Art" {
+		t.Errorf("expected category Art, got %q", entry.Category)
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"time"
+)
+
+// healthCheckTimeout limits every dependency check of a readiness report.
+const healthCheckTimeout = 5 * time.Second
+
+// HealthService reports the liveness of the poll loop and the readiness of the dependencies of the service.
+type HealthService struct {
+	notifications *NotificationService
+	streams       *StreamService
+	interval      time.Duration
+	checkers      []namedChecker
+}
+
+var _ port.HealthReporter = (*HealthService)(nil)
+
+type namedChecker struct {
+	name    string
+	checker port.HealthChecker
+}
+
+// NewHealthService considers the poll loop alive if it ticked within two polling intervals.
+func NewHealthService(notifications *NotificationService,
+	streams *StreamService,
+	interval time.Duration) *HealthService {
+	return &HealthService{notifications: notifications, streams: streams, interval: interval}
+}
+
+// AddCheck adds a dependency to the readiness report.
+func (h *HealthService) AddCheck(name string, checker port.HealthChecker) {
+	h.checkers = append(h.checkers, namedChecker{name: name, checker: checker})
+}
+
+func (h *HealthService) Liveness(_ context.Context) domain.HealthReport {
+	started, lastTick := h.notifications.pollTimes()
+
+	check := domain.HealthCheck{Name: "poll_loop", Status: domain.HealthStatusOK, Time: lastTick}
+	if lastTick.IsZero() {
+		check.Time = started
+	}
+
+	switch {
+	case started.IsZero():
+		check.Status = domain.HealthStatusFailing
+		check.Message = "polling not started"
+	case time.Since(check.Time) > 2*h.interval:
+		check.Status = domain.HealthStatusFailing
+		check.Message = fmt.Sprintf("no poll within %s", 2*h.interval)
+	}
+
+	return domain.NewHealthReport([]domain.HealthCheck{check})
+}
+
+func (h *HealthService) Readiness(ctx context.Context) domain.HealthReport {
+	checks := make([]domain.HealthCheck, len(h.checkers))
+
+	// dependencies are checked concurrently to answer within the timeout
+	done := make(chan struct{})
+	for i, c := range h.checkers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			checks[i] = domain.HealthCheck{Name: c.name, Status: domain.HealthStatusOK, Time: time.Now()}
+			err := c.checker.CheckHealth(ctx)
+			if err != nil {
+				checks[i].Status = domain.HealthStatusFailing
+				checks[i].Message = err.Error()
+			}
+		}()
+	}
+	for range h.checkers {
+		<-done
+	}
+
+	return domain.NewHealthReport(append(checks, h.pollChecks()...))
+}
+
+// pollChecks reports the outcome of the last poll of every provider.
+func (h *HealthService) pollChecks() []domain.HealthCheck {
+	_, lastTick := h.notifications.pollTimes()
+	if lastTick.IsZero() {
+		return []domain.HealthCheck{{
+			Name:    "poll",
+			Status:  domain.HealthStatusPending,
+			Message: "waiting for the first poll",
+		}}
+	}
+
+	polls := h.streams.lastPolls()
+	checks := make([]domain.HealthCheck, 0, len(polls))
+	for kind, result := range polls {
+		check := domain.HealthCheck{Name: "poll_" + string(kind), Status: domain.HealthStatusOK, Time: result.time}
+		if result.err != nil {
+			check.Status = domain.HealthStatusFailing
+			check.Message = result.err.Error()
+		}
+		checks = append(checks, check)
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name < checks[j].Name
+	})
+
+	return checks
+}
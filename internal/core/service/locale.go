@@ -0,0 +1,290 @@
+package service
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultLocale is the fallback for missing locales and messages.
+const DefaultLocale = "en"
+
+//go:embed locales
+var embeddedLocales embed.FS
+
+// pluralRules map the rule names of the translation files to a function selecting the plural form of a count.
+var pluralRules = map[string]func(n int) string{
+	// English, German, Spanish, ...
+	"one_other": func(n int) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	// French, Portuguese, ...
+	"zero_one_other": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	// Russian, Ukrainian, Polish, ...
+	"slavic": func(n int) string {
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	},
+	// Japanese, Chinese, ...
+	"none": func(int) string {
+		return "other"
+	},
+}
+
+// Locale holds the messages and number format of a language.
+type Locale struct {
+	Name     string
+	plural   func(n int) string
+	group    string
+	grouping int
+	messages map[string]map[string]string
+	fallback *Locale
+}
+
+type localeFile struct {
+	Plural string `yaml:"plural"`
+	Number struct {
+		Group       string `yaml:"group"`
+		MinGrouping int    `yaml:"min_grouping"`
+	} `yaml:"number"`
+	// Messages are either a format string or a map of plural forms to format strings.
+	Messages map[string]any `yaml:"messages"`
+}
+
+// Catalog holds all available locales by lowercase name.
+type Catalog struct {
+	locales map[string]*Locale
+}
+
+// LoadCatalog loads the built-in translations and the translation files in dir, which add languages or replace
+// built-in ones. Files are named after their locale, e.g. "de.yml".
+func LoadCatalog(dir string) (*Catalog, error) {
+	c := &Catalog{locales: make(map[string]*Locale)}
+
+	sub, err := fs.Sub(embeddedLocales, "locales")
+	if err != nil {
+		return nil, fmt.Errorf("error reading built-in locales: %w", err)
+	}
+	err = c.load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		err = c.load(os.DirFS(dir))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fallback, ok := c.locales[DefaultLocale]
+	if !ok {
+		return nil, errors.New("default locale " + DefaultLocale + " is missing")
+	}
+	for name, l := range c.locales {
+		if name == DefaultLocale {
+			continue
+		}
+		l.fallback = fallback
+
+		for key := range fallback.messages {
+			if _, ok := l.messages[key]; !ok {
+				log.Warn().Str("locale", name).Str("key", key).Msg("missing translation, using " + DefaultLocale)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Catalog) load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.y*ml")
+	if err != nil {
+		return fmt.Errorf("error listing locales: %w", err)
+	}
+
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("error reading locale %s: %w", file, err)
+		}
+
+		name := strings.ToLower(strings.TrimSuffix(file, filepath.Ext(file)))
+		l, err := parseLocale(name, b)
+		if err != nil {
+			return fmt.Errorf("invalid locale %s: %w", file, err)
+		}
+
+		c.locales[name] = l
+	}
+
+	return nil
+}
+
+func parseLocale(name string, b []byte) (*Locale, error) {
+	var file localeFile
+	err := yaml.Unmarshal(b, &file)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing yaml: %w", err)
+	}
+
+	if file.Plural == "" {
+		file.Plural = "one_other"
+	}
+	plural, ok := pluralRules[file.Plural]
+	if !ok {
+		return nil, fmt.Errorf("unknown plural rule %q", file.Plural)
+	}
+	if file.Number.MinGrouping <= 0 {
+		file.Number.MinGrouping = 1
+	}
+
+	l := &Locale{
+		Name:     name,
+		plural:   plural,
+		group:    file.Number.Group,
+		grouping: file.Number.MinGrouping,
+		messages: make(map[string]map[string]string),
+	}
+
+	for key, value := range file.Messages {
+		switch v := value.(type) {
+		case string:
+			l.messages[key] = map[string]string{"other": v}
+		case map[string]any:
+			forms := make(map[string]string)
+			for form, text := range v {
+				s, ok := text.(string)
+				if !ok {
+					return nil, fmt.Errorf("plural form %s of message %s is not a string", form, key)
+				}
+				forms[form] = s
+			}
+			if _, ok := forms["other"]; !ok && file.Plural != "slavic" {
+				return nil, fmt.Errorf("message %s has no plural form other", key)
+			}
+			l.messages[key] = forms
+		default:
+			return nil, fmt.Errorf("message %s must be a string or a map of plural forms", key)
+		}
+	}
+
+	return l, nil
+}
+
+// Get returns a locale by name, falling back to the language without region and then to DefaultLocale.
+func (c *Catalog) Get(name string) (*Locale, error) {
+	name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	if name == "" {
+		name = DefaultLocale
+	}
+
+	if l, ok := c.locales[name]; ok {
+		return l, nil
+	}
+	if language, _, found := strings.Cut(name, "-"); found {
+		if l, ok := c.locales[language]; ok {
+			return l, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown locale %q", name)
+}
+
+// Translate formats a message with args, returning the key if no translation exists.
+func (l *Locale) Translate(key string, args ...any) string {
+	return l.format(key, "other", noEscape, args...)
+}
+
+// Plural formats the plural form of a message for a count, the localized count is the first argument.
+func (l *Locale) Plural(key string, n int, args ...any) string {
+	return l.format(key, l.plural(n), noEscape, append([]any{l.Number(n)}, args...)...)
+}
+
+// format escapes the message before inserting the args, which are expected to be escaped already.
+func (l *Locale) format(key string, form string, escape func(string) string, args ...any) string {
+	for locale := l; locale != nil; locale = locale.fallback {
+		forms, ok := locale.messages[key]
+		if !ok {
+			continue
+		}
+
+		text, ok := forms[form]
+		if !ok {
+			text, ok = forms["other"]
+		}
+		if !ok {
+			continue
+		}
+
+		return fmt.Sprintf(escape(text), args...)
+	}
+
+	return escape(key)
+}
+
+// Number formats an integer with the group separator of the locale.
+func (l *Locale) Number(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	if len(digits) < 3+l.grouping {
+		return sign + digits
+	}
+
+	var b strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(r)
+	}
+
+	return sign + b.String()
+}
+
+func noEscape(text string) string {
+	return text
+}
+
+// funcs returns the template helpers bound to the locale, escaping their output.
+func (l *Locale) funcs(escape func(string) string) template.FuncMap {
+	return template.FuncMap{
+		"esc": escape,
+		"tr": func(key string, args ...any) string {
+			return l.format(key, "other", escape, args...)
+		},
+		"plural": func(key string, n int, args ...any) string {
+			return l.format(key, l.plural(n), escape, append([]any{escape(l.Number(n))}, args...)...)
+		},
+		"number": func(n int) string {
+			return escape(l.Number(n))
+		},
+	}
+}
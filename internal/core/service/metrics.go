@@ -0,0 +1,16 @@
+package service
+
+import (
+	"streamobserver/internal/core/domain"
+	"time"
+)
+
+// nopMetrics discards all metrics, used until a port.Metrics is set.
+type nopMetrics struct{}
+
+func (nopMetrics) ObservePoll(domain.StreamKind, time.Duration, error)    {}
+func (nopMetrics) ObserveHTTPResponse(domain.StreamKind, int)             {}
+func (nopMetrics) ObserveTokenRefresh(domain.StreamKind, error)           {}
+func (nopMetrics) SetObserved(int, int)                                   {}
+func (nopMetrics) ObserveStreams([]domain.StreamInfo)                     {}
+func (nopMetrics) ObserveNotification(domain.NotifierKind, string, error) {}
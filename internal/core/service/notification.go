@@ -2,8 +2,12 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"streamobserver/internal/core/domain"
 	"streamobserver/internal/core/port"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -11,38 +15,96 @@ import (
 )
 
 type NotificationService struct {
-	notifier port.Notifier
+	notifiers map[domain.NotifierKind]port.Notifier
 	// TODO: combine stream getters into service agnostic interface
 	streamGetter port.StreamInfoService
-	streams      map[*domain.StreamQuery]domain.ObservedStream
+	// mu guards the observed streams, read concurrently by the status API and written by the notifications
+	mu      sync.Mutex
+	streams map[*domain.StreamQuery]domain.ObservedStream
+	// notifying holds the completion of the last notification started for a stream, notifications of the same
+	// stream run one at a time so a slow send is not duplicated by the next poll
+	notifying map[*domain.StreamQuery]chan struct{}
+	sessions  port.SessionStore
+	listeners []port.SessionListener
+	changes   []port.ChangeListener
+	metrics   port.Metrics
+	// started and lastTick are Unix nanoseconds, zero until polling started and the first tick
+	started  atomic.Int64
+	lastTick atomic.Int64
 }
 
 var _ port.NotificationBroker = (*NotificationService)(nil)
 
-func NewNotificationService(n port.Notifier, m port.StreamInfoService) *NotificationService {
-	return &NotificationService{
-		notifier:     n,
+func NewNotificationService(m port.StreamInfoService, notifiers ...port.Notifier) *NotificationService {
+	srv := &NotificationService{
+		notifiers:    make(map[domain.NotifierKind]port.Notifier),
 		streamGetter: m,
 		streams:      make(map[*domain.StreamQuery]domain.ObservedStream),
+		notifying:    make(map[*domain.StreamQuery]chan struct{}),
+		metrics:      nopMetrics{},
 	}
+
+	for _, notifier := range notifiers {
+		srv.notifiers[notifier.Kind()] = notifier
+
+		if reporter, ok := notifier.(port.DeliveryReporter); ok {
+			kind := notifier.Kind()
+			reporter.OnDeliveryFailed(func(target string, messageID string, err error) {
+				srv.deliveryFailed(domain.Target{Kind: kind, ID: target}, messageID, err)
+			})
+		}
+	}
+
+	return srv
 }
 
-func (n *NotificationService) Register(target int64, query *domain.StreamQuery) {
-	log.Info().Str("id", query.UserID).Int64("target", target).Msg("registering stream")
+// SetSessionStore records the tracked sessions of all streams in a store.
+func (n *NotificationService) SetSessionStore(store port.SessionStore) {
+	n.sessions = store
+}
+
+// AddSessionListener calls a listener whenever the session of a stream ended.
+func (n *NotificationService) AddSessionListener(listener port.SessionListener) {
+	n.listeners = append(n.listeners, listener)
+}
+
+// AddChangeListener calls a listener after every poll and whenever the observed streams changed.
+func (n *NotificationService) AddChangeListener(listener port.ChangeListener) {
+	n.changes = append(n.changes, listener)
+}
+
+// SetMetrics records the observed streams, the polled infos and the outcome of all notifier calls.
+func (n *NotificationService) SetMetrics(metrics port.Metrics) {
+	n.metrics = metrics
+}
+
+func (n *NotificationService) Register(target domain.Target,
+	query *domain.StreamQuery,
+	policy domain.OfflinePolicy) error {
+	log.Info().Str("id", query.UserID).Stringer("target", target).Msg("registering stream")
+
+	if _, ok := n.notifiers[target.Kind]; !ok {
+		return fmt.Errorf("no notifier configured for target %s", target)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
 	queryFound := false
 	for k, v := range n.streams {
 		if k.Equals(*query) {
 			queryFound = true
 			targetFound := false
-			for _, observer := range v.Observers {
-				if observer.ChannelID == target {
+			for i, observer := range v.Observers {
+				if observer.Target == target {
 					targetFound = true
+					v.Observers[i].OfflinePolicy = policy
 				}
 			}
 			if !targetFound {
 				v.Observers = append(v.Observers, domain.Observer{
-					ChannelID: target,
+					Target:        target,
+					OfflinePolicy: policy,
 				})
 				n.streams[k] = v
 			}
@@ -53,88 +115,388 @@ func (n *NotificationService) Register(target int64, query *domain.StreamQuery)
 		n.streams[query] = domain.ObservedStream{
 			Observers: []domain.Observer{
 				{
-					ChannelID: target,
+					Target:        target,
+					OfflinePolicy: policy,
 				},
 			},
 		}
 	}
 
 	log.Debug().Int("totalObserved", len(n.streams)).Msg("register successful")
+	n.changed()
+
+	return nil
+}
+
+func (n *NotificationService) Unregister(target domain.Target, query domain.StreamQuery) error {
+	log.Info().Str("id", query.UserID).Stringer("target", target).Msg("unregistering stream")
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for k, v := range n.streams {
+		if !k.Equals(query) {
+			continue
+		}
+
+		for i, observer := range v.Observers {
+			if observer.Target != target {
+				continue
+			}
+
+			v.Observers = slices.Delete(slices.Clone(v.Observers), i, i+1)
+			if len(v.Observers) == 0 {
+				delete(n.streams, k)
+			} else {
+				n.streams[k] = v
+			}
+
+			log.Debug().Int("totalObserved", len(n.streams)).Msg("unregister successful")
+			n.changed()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("stream %s/%s of target %s %w", query.Kind, query.UserID, target, domain.ErrNotFound)
 }
 
 func (n *NotificationService) StartPolling(ctx context.Context) {
 	log.Debug().Msg("starting poll routine")
+	n.started.Store(time.Now().UnixNano())
 
-	for range time.Tick(viper.GetDuration("general.polling_interval")) {
+	for tick := range time.Tick(viper.GetDuration("general.polling_interval")) {
 		log.Debug().Msg("tick, querying streams")
+		n.lastTick.Store(tick.UnixNano())
 
-		queries := make([]*domain.StreamQuery, 0)
-		for k := range n.streams {
-			log.Debug().Str("id", k.UserID).Msg("adding stream id to query list")
-			queries = append(queries, k)
-		}
+		queries := n.queries()
 
+		// streams that failed are left out and keep their state until the next poll
 		infos, err := n.streamGetter.GetStreamInfos(ctx, queries)
 		if err != nil {
 			log.Err(err).Msg("failed to get stream infos")
-			continue
 		}
+		n.metrics.ObserveStreams(infos)
 
-		for _, info := range infos {
-			s := n.streams[info.Query]
+		n.update(ctx, infos)
+		n.changed()
+	}
+}
 
-			log.Debug().Str("id", info.Query.UserID).Msg("checking if notification is needed")
+// queries returns the queries of all observed streams.
+func (n *NotificationService) queries() []*domain.StreamQuery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
-			if !s.LatestInfo.Equals(info) {
-				if !info.IsOnline && s.PublishedOfflineStatus {
-					continue
-				}
-				if info.IsOnline {
-					s.PublishedOfflineStatus = false
-				}
+	queries := make([]*domain.StreamQuery, 0)
+	observers := 0
+	for k, v := range n.streams {
+		log.Debug().Str("id", k.UserID).Msg("adding stream id to query list")
+		queries = append(queries, k)
+		observers += len(v.Observers)
+	}
+	n.metrics.SetObserved(len(queries), observers)
 
-				// updated info on offline streams does not contain metadata, fill and send once, clear message ID
-				if !info.IsOnline && !s.PublishedOfflineStatus {
-					info = s.LatestInfo
-					info.IsOnline = false
-					s.PublishedOfflineStatus = true
-				}
+	return queries
+}
+
+// update tracks the sessions of the polled streams and notifies the observers of changed streams. The changed
+// sessions are saved and the session listeners called without holding the lock.
+func (n *NotificationService) update(ctx context.Context, infos []domain.StreamInfo) {
+	for _, t := range n.updateStreams(ctx, infos) {
+		n.saveSession(ctx, t.info, t.session)
+		if !t.info.IsOnline {
+			for _, listener := range n.listeners {
+				listener.SessionEnded(t.latest, *t.session)
+			}
+		}
+	}
+}
 
-				log.Info().
-					Str("stream", info.Username).
-					Bool("online", info.IsOnline).
-					Msg("stream status update, notifying")
-				go n.notify(ctx, &s, info)
+// updateStreams applies the polled infos to the observed streams and returns the changed sessions.
+func (n *NotificationService) updateStreams(ctx context.Context, infos []domain.StreamInfo) []trackedSession {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
-				s.LatestInfo = info
-				n.streams[info.Query] = s
+	saved := make([]trackedSession, 0)
+
+	for _, info := range infos {
+		s, ok := n.streams[info.Query]
+		if !ok {
+			// unregistered while polling
+			continue
+		}
+
+		if trackSession(&s, info, time.Now()) {
+			saved = append(saved, trackedSession{info: info, latest: s.LatestInfo, session: s.Session.Clone()})
+		}
+		n.streams[info.Query] = s
+
+		log.Debug().Str("id", info.Query.UserID).Msg("checking if notification is needed")
+
+		if !s.LatestInfo.Equals(info) {
+			if !info.IsOnline && s.PublishedOfflineStatus {
+				continue
+			}
+			if info.IsOnline {
+				s.PublishedOfflineStatus = false
+			}
+
+			// updated info on offline streams does not contain metadata, fill and send once, clear message ID
+			if !info.IsOnline && !s.PublishedOfflineStatus {
+				info = s.LatestInfo
+				info.IsOnline = false
+				s.PublishedOfflineStatus = true
 			}
+			info.Session = s.Session.Clone()
+
+			log.Info().
+				Str("stream", info.Username).
+				Bool("online", info.IsOnline).
+				Msg("stream status update, notifying")
+			n.startNotify(ctx, s.PublishedOfflineStatus, info)
+
+			s.LatestInfo = info
+			n.streams[info.Query] = s
 		}
 	}
+
+	return saved
+}
+
+// trackedSession is a copy of a changed session with the polled info and the last notified info of its stream.
+type trackedSession struct {
+	info    domain.StreamInfo
+	latest  domain.StreamInfo
+	session *domain.Session
 }
 
-func (n *NotificationService) notify(ctx context.Context, observed *domain.ObservedStream, info domain.StreamInfo) {
-	for i, observer := range observed.Observers {
-		log.Info().Int64("target", observer.ChannelID).Str("stream", info.Username).Msg("notifying observer")
-		if observer.MessageID == 0 {
-			log.Debug().Int64("observer", observer.ChannelID).Msg("first trigger, sending info")
-			id, err := n.notifier.SendStreamInfo(ctx, observer.ChannelID, info)
+// startNotify notifies the observers of a stream in the background once the previous notification of the stream
+// finished. Must be called with the lock held.
+func (n *NotificationService) startNotify(ctx context.Context, publishedOffline bool, info domain.StreamInfo) {
+	previous := n.notifying[info.Query]
+	done := make(chan struct{})
+	n.notifying[info.Query] = done
+
+	go func() {
+		if previous != nil {
+			<-previous
+		}
+		n.notify(ctx, publishedOffline, info)
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		close(done)
+		if n.notifying[info.Query] == done {
+			delete(n.notifying, info.Query)
+		}
+	}()
+}
+
+// notify sends the info to the current observers of a stream, recording the message IDs and errors in the observed
+// stream.
+func (n *NotificationService) notify(ctx context.Context, publishedOffline bool, info domain.StreamInfo) {
+	observers := n.observers(info.Query)
+	for _, observer := range observers {
+		log.Info().Stringer("target", observer.Target).Str("stream", info.Username).Msg("notifying observer")
+		notifier := n.notifiers[observer.Target.Kind]
+		if observer.MessageID == "" {
+			log.Debug().Stringer("observer", observer.Target).Msg("first trigger, sending info")
+			id, err := notifier.SendStreamInfo(ctx, observer.Target.ID, info)
+			n.metrics.ObserveNotification(notifier.Kind(), "send", err)
+			if err != nil {
+				log.Err(err).Stringer("observer", observer.Target).Msg("failed to send info")
+			}
+			n.updateObserver(info.Query, observer.Target, id, err)
+		} else if !info.IsOnline {
+			err := n.notifyOffline(ctx, notifier, observer, info)
+			n.updateObserver(info.Query, observer.Target, observer.MessageID, err)
+			n.streamEnded(ctx, notifier, observer)
+		} else if replacer, ok := notifier.(port.MessageReplacer); ok {
+			log.Debug().Stringer("observer", observer.Target).Msg("later trigger, replacing info")
+			id, err := replacer.ReplaceStreamInfo(ctx, observer.Target.ID, observer.MessageID, info)
+			n.metrics.ObserveNotification(notifier.Kind(), "edit", err)
 			if err != nil {
-				log.Err(err).Int64("observer", observer.ChannelID).Msg("failed to send info")
+				log.Err(err).Stringer("observer", observer.Target).Msg("failed to update info")
 			}
-			observed.Observers[i].MessageID = id
+			if id == "" {
+				id = observer.MessageID
+			}
+			n.updateObserver(info.Query, observer.Target, id, err)
 		} else {
-			log.Debug().Int64("observer", observer.ChannelID).Msg("later trigger, updating info")
-			err := n.notifier.UpdateStreamInfo(ctx, observer.ChannelID, observer.MessageID, info)
+			log.Debug().Stringer("observer", observer.Target).Msg("later trigger, updating info")
+			err := notifier.UpdateStreamInfo(ctx, observer.Target.ID, observer.MessageID, info)
+			n.metrics.ObserveNotification(notifier.Kind(), "edit", err)
 			if err != nil {
-				log.Err(err).Int64("observer", observer.ChannelID).Msg("failed to update info")
+				log.Err(err).Stringer("observer", observer.Target).Msg("failed to update info")
 			}
+			n.updateObserver(info.Query, observer.Target, observer.MessageID, err)
 		}
 	}
 
-	if observed.PublishedOfflineStatus {
-		for i := range observed.Observers {
-			observed.Observers[i].MessageID = 0
+	if publishedOffline {
+		for _, observer := range observers {
+			n.clearMessageID(info.Query, observer.Target)
+		}
+	}
+}
+
+// observers returns a copy of the observers of a stream.
+func (n *NotificationService) observers(query *domain.StreamQuery) []domain.Observer {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return slices.Clone(n.streams[query].Observers)
+}
+
+// updateObserver records the message ID and the outcome of notifying an observer.
+func (n *NotificationService) updateObserver(query *domain.StreamQuery, target domain.Target, id string, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, observer := range n.streams[query].Observers {
+		if observer.Target != target {
+			continue
+		}
+		n.streams[query].Observers[i].MessageID = id
+		n.streams[query].Observers[i].LastError = ""
+		if err != nil {
+			n.streams[query].Observers[i].LastError = err.Error()
 		}
 	}
+	n.changed()
+}
+
+// deliveryFailed records the error of a message sent in the background on the observers it was sent to.
+func (n *NotificationService) deliveryFailed(target domain.Target, messageID string, err error) {
+	log.Err(err).Stringer("observer", target).Str("id", messageID).Msg("failed to deliver info")
+	n.metrics.ObserveNotification(target.Kind, "deliver", err)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for query, s := range n.streams {
+		for i, observer := range s.Observers {
+			if observer.Target == target && observer.MessageID == messageID {
+				n.streams[query].Observers[i].LastError = err.Error()
+			}
+		}
+	}
+	n.changed()
+}
+
+func (n *NotificationService) clearMessageID(query *domain.StreamQuery, target domain.Target) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, observer := range n.streams[query].Observers {
+		if observer.Target == target {
+			n.streams[query].Observers[i].MessageID = ""
+		}
+	}
+}
+
+// notifyOffline applies the offline policy of an observer, falling back to editing the message if the notifier lacks
+// the capability.
+func (n *NotificationService) notifyOffline(ctx context.Context,
+	notifier port.Notifier,
+	observer domain.Observer,
+	info domain.StreamInfo) error {
+	log.Debug().Stringer("observer", observer.Target).Str("policy", string(observer.OfflinePolicy)).
+		Msg("stream ended, applying offline policy")
+
+	switch observer.OfflinePolicy {
+	case domain.OfflinePolicyIgnore:
+		return nil
+	case domain.OfflinePolicyDelete:
+		if deleter, ok := notifier.(port.MessageDeleter); ok {
+			err := deleter.DeleteStreamInfo(ctx, observer.Target.ID, observer.MessageID)
+			n.metrics.ObserveNotification(notifier.Kind(), "delete", err)
+			if err != nil {
+				log.Err(err).Stringer("observer", observer.Target).Msg("failed to delete info")
+			}
+			return err
+		}
+		log.Warn().Stringer("observer", observer.Target).Msg("notifier can not delete messages, editing instead")
+	case domain.OfflinePolicyRepost:
+		if replier, ok := notifier.(port.MessageReplier); ok {
+			_, err := replier.ReplyStreamInfo(ctx, observer.Target.ID, observer.MessageID, info)
+			n.metrics.ObserveNotification(notifier.Kind(), "reply", err)
+			if err != nil {
+				log.Err(err).Stringer("observer", observer.Target).Msg("failed to reply with info")
+			}
+			return err
+		}
+		log.Warn().Stringer("observer", observer.Target).Msg("notifier can not reply to messages, editing instead")
+	}
+
+	err := notifier.UpdateStreamInfo(ctx, observer.Target.ID, observer.MessageID, info)
+	n.metrics.ObserveNotification(notifier.Kind(), "edit", err)
+	if err != nil {
+		log.Err(err).Stringer("observer", observer.Target).Msg("failed to update info")
+	}
+	return err
+}
+
+// streamEnded lets the notifier release the state of the message of an observer, if it keeps any.
+func (n *NotificationService) streamEnded(ctx context.Context, notifier port.Notifier, observer domain.Observer) {
+	listener, ok := notifier.(port.StreamEndListener)
+	if !ok {
+		return
+	}
+
+	err := listener.StreamEnded(ctx, observer.Target.ID, observer.MessageID)
+	if err != nil {
+		log.Warn().Err(err).Stringer("observer", observer.Target).Msg("failed to release message state")
+	}
+}
+
+// saveSession records the state of a session, with the viewer count of a live stream as sample.
+func (n *NotificationService) saveSession(ctx context.Context, info domain.StreamInfo, session *domain.Session) {
+	if n.sessions == nil {
+		return
+	}
+
+	viewers := -1
+	if info.IsOnline {
+		viewers = info.ViewerCount
+	}
+
+	err := n.sessions.SaveSession(ctx, *info.Query, *session, viewers)
+	if err != nil {
+		log.Err(err).Str("stream", info.Query.UserID).Msg("failed to save session")
+	}
+}
+
+// pollTimes returns when polling started and the time of the last tick, zero if not yet.
+func (n *NotificationService) pollTimes() (started time.Time, lastTick time.Time) {
+	return unixTime(n.started.Load()), unixTime(n.lastTick.Load())
+}
+
+func unixTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// observed returns a copy of the state of all observed streams.
+func (n *NotificationService) observed() map[*domain.StreamQuery]domain.ObservedStream {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	streams := make(map[*domain.StreamQuery]domain.ObservedStream, len(n.streams))
+	for query, s := range n.streams {
+		s.Observers = slices.Clone(s.Observers)
+		s.Session = s.Session.Clone()
+		s.LatestInfo.Session = s.LatestInfo.Session.Clone()
+		streams[query] = s
+	}
+	return streams
+}
+
+// changed calls the change listeners, which do not block and may be called with the lock held.
+func (n *NotificationService) changed() {
+	for _, listener := range n.changes {
+		listener.StreamsChanged()
+	}
 }
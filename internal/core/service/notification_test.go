@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+// slowNotifier blocks every send until released and records all calls.
+type slowNotifier struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	sent    int
+	updates []string
+	calls   chan struct{}
+}
+
+func newSlowNotifier() *slowNotifier {
+	return &slowNotifier{release: make(chan struct{}), calls: make(chan struct{}, 10)}
+}
+
+func (s *slowNotifier) SendStreamInfo(ctx context.Context, _ string, _ domain.StreamInfo) (string, error) {
+	s.calls <- struct{}{}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+	return fmt.Sprintf("message-%d", s.sent), nil
+}
+
+func (s *slowNotifier) UpdateStreamInfo(_ context.Context, _ string, messageID string, _ domain.StreamInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, messageID)
+	s.calls <- struct{}{}
+	return nil
+}
+
+func (s *slowNotifier) Kind() domain.NotifierKind {
+	return domain.NotifierKindTelegram
+}
+
+func (s *slowNotifier) wait(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-s.calls:
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for notifier call")
+	}
+}
+
+func TestUpdate_SlowSendIsNotDuplicated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notifier := newSlowNotifier()
+	n := NewNotificationService(nil, notifier)
+
+	query := &domain.StreamQuery{UserID: "streamer", Kind: domain.StreamKindTwitch}
+	target := domain.Target{Kind: domain.NotifierKindTelegram, ID: "1"}
+	if err := n.Register(target, query, domain.OfflinePolicyEdit); err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+
+	info := domain.StreamInfo{Query: query, Username: "streamer", Title: "first", IsOnline: true}
+	n.update(ctx, []domain.StreamInfo{info})
+	notifier.wait(t)
+
+	// the send is still waiting when the next poll changes the stream
+	info.Title = "second"
+	n.update(ctx, []domain.StreamInfo{info})
+
+	close(notifier.release)
+	notifier.wait(t)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+
+	if notifier.sent != 1 {
+		t.Errorf("expected one sent message, got %d", notifier.sent)
+	}
+	if len(notifier.updates) != 1 || notifier.updates[0] != "message-1" {
+		t.Errorf("expected one update of message-1, got %v", notifier.updates)
+	}
+}
+
+// asyncNotifier returns a fixed message handle and reports its delivery later.
+type asyncNotifier struct {
+	report func(target string, messageID string, err error)
+}
+
+func (a *asyncNotifier) SendStreamInfo(context.Context, string, domain.StreamInfo) (string, error) {
+	return "message", nil
+}
+
+func (a *asyncNotifier) UpdateStreamInfo(context.Context, string, string, domain.StreamInfo) error {
+	return nil
+}
+
+func (a *asyncNotifier) Kind() domain.NotifierKind {
+	return domain.NotifierKindEmail
+}
+
+func (a *asyncNotifier) OnDeliveryFailed(report func(target string, messageID string, err error)) {
+	a.report = report
+}
+
+func TestDeliveryFailed_RecordsObserverError(t *testing.T) {
+	notifier := &asyncNotifier{}
+	n := NewNotificationService(nil, notifier)
+
+	query := &domain.StreamQuery{UserID: "streamer", Kind: domain.StreamKindTwitch}
+	target := domain.Target{Kind: domain.NotifierKindEmail, ID: "viewer@example.com"}
+	if err := n.Register(target, query, domain.OfflinePolicyEdit); err != nil {
+		t.Fatalf("error registering: %v", err)
+	}
+
+	n.notify(context.Background(), false, domain.StreamInfo{Query: query, Username: "streamer", IsOnline: true})
+	notifier.report(target.ID, "message", errors.New("connection refused"))
+
+	observer := n.observers(query)[0]
+	if observer.MessageID != "message" {
+		t.Errorf("expected message id to be kept, got %q", observer.MessageID)
+	}
+	if observer.LastError != "connection refused" {
+		t.Errorf("expected delivery error on observer, got %q", observer.LastError)
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"streamobserver/internal/core/domain"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// trackSession updates the session of a stream with a polled info and reports whether it changed. A session starts
+// when the stream goes live, at the start time reported by the service if known, and ends with the first offline poll.
+func trackSession(s *domain.ObservedStream, info domain.StreamInfo, now time.Time) bool {
+	session := s.Session
+
+	if !info.IsOnline {
+		if session != nil && session.Live() {
+			session.EndedAt = now
+			log.Debug().Str("stream", info.Query.UserID).Dur("duration", session.Duration()).Msg("session ended")
+			return true
+		}
+		return false
+	}
+
+	switch {
+	case session != nil && session.Live():
+	case session != nil && !info.StartedAt.IsZero() && info.StartedAt.Equal(session.StartedAt):
+		// the service missed the stream for a poll, the broadcast continues
+		session.EndedAt = time.Time{}
+		log.Debug().Str("stream", info.Query.UserID).Msg("session resumed")
+	default:
+		started := info.StartedAt
+		if started.IsZero() || started.After(now) {
+			started = now
+		}
+		session = &domain.Session{StartedAt: started}
+		s.Session = session
+		log.Debug().Str("stream", info.Query.UserID).Time("started", started).Msg("session started")
+	}
+
+	if info.ViewerCount >= 0 {
+		session.ViewerSum += int64(info.ViewerCount)
+		session.Samples++
+		session.PeakViewers = max(session.PeakViewers, info.ViewerCount)
+	}
+
+	last := len(session.Changes) - 1
+	if last < 0 || session.Changes[last].Title != info.Title || session.Changes[last].Category != info.Category {
+		session.Changes = append(session.Changes, domain.SessionChange{
+			Time:     now,
+			Title:    info.Title,
+			Category: info.Category,
+		})
+	}
+
+	return true
+}
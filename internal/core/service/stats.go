@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"time"
+)
+
+// heatmapShades are the characters of the heatmap cells, from no streaming to the most streamed hour.
+var heatmapShades = []rune(" ░▒▓█")
+
+// StatsService summarizes the sessions recorded in a port.SessionStore.
+type StatsService struct {
+	store    port.SessionStore
+	location *time.Location
+}
+
+var _ port.StatsReporter = (*StatsService)(nil)
+
+// NewStatsService creates a StatsService bucketing the heatmap in location, time.Local if nil.
+func NewStatsService(store port.SessionStore, location *time.Location) *StatsService {
+	if location == nil {
+		location = time.Local
+	}
+	return &StatsService{store: store, location: location}
+}
+
+// Stats summarizes the sessions of a stream started since a time.
+func (s *StatsService) Stats(ctx context.Context, query domain.StreamQuery, since time.Time) (domain.StreamStats, error) {
+	sessions, err := s.store.Sessions(ctx, query, since)
+	if err != nil {
+		return domain.StreamStats{}, err
+	}
+
+	stats := domain.StreamStats{Query: query, Sessions: len(sessions)}
+
+	var viewerSum int64
+	var samples int
+	for _, session := range sessions {
+		duration := session.Duration()
+		stats.Total += duration
+		stats.Longest = max(stats.Longest, duration)
+		stats.PeakViewers = max(stats.PeakViewers, session.PeakViewers)
+		viewerSum += session.ViewerSum
+		samples += session.Samples
+
+		// split the session at the hours of the day
+		for start := session.StartedAt.In(s.location); start.Before(session.EndedAt); {
+			hour := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, s.location)
+			end := hour.Add(time.Hour)
+			if end.After(session.EndedAt) {
+				end = session.EndedAt.In(s.location)
+			}
+			stats.Heatmap[start.Weekday()][start.Hour()] += end.Sub(start)
+			start = end
+		}
+	}
+
+	if stats.Sessions > 0 {
+		stats.Average = stats.Total / time.Duration(stats.Sessions)
+	}
+	if samples > 0 {
+		stats.AverageViewers = int(viewerSum / int64(samples))
+	}
+
+	return stats, nil
+}
+
+// Report formats the statistics of a stream given as "kind/id", "kind/id@baseurl" or a unique id.
+func (s *StatsService) Report(ctx context.Context, stream string, since time.Time) (string, error) {
+	query, err := s.find(ctx, stream)
+	if err != nil {
+		return "", err
+	}
+
+	stats, err := s.Stats(ctx, query, since)
+	if err != nil {
+		return "", err
+	}
+
+	return formatStats(stats), nil
+}
+
+// Streams returns the names of all streams with recorded sessions.
+func (s *StatsService) Streams(ctx context.Context) ([]string, error) {
+	queries, err := s.store.Streams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(queries))
+	for _, query := range queries {
+		names = append(names, streamName(query))
+	}
+	return names, nil
+}
+
+func (s *StatsService) find(ctx context.Context, stream string) (domain.StreamQuery, error) {
+	queries, err := s.store.Streams(ctx)
+	if err != nil {
+		return domain.StreamQuery{}, err
+	}
+
+	matches := make([]domain.StreamQuery, 0, 1)
+	for _, query := range queries {
+		if strings.EqualFold(stream, streamName(query)) ||
+			strings.EqualFold(stream, string(query.Kind)+"/"+query.UserID) ||
+			strings.EqualFold(stream, query.UserID) {
+			matches = append(matches, query)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return domain.StreamQuery{}, fmt.Errorf("no sessions recorded for stream %q", stream)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, query := range matches {
+			names = append(names, streamName(query))
+		}
+		return domain.StreamQuery{}, errors.New("ambiguous stream, use one of " + strings.Join(names, ", "))
+	}
+}
+
+// streamName identifies a stream as "kind/id", with "@baseurl" for self-hosted services.
+func streamName(query domain.StreamQuery) string {
+	name := string(query.Kind) + "/" + query.UserID
+	if query.BaseURL != "" {
+		name += "@" + query.BaseURL
+	}
+	return name
+}
+
+// formatStats renders the statistics as plain text, the heatmap is meant for a monospace font.
+func formatStats(stats domain.StreamStats) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n", streamName(stats.Query))
+	fmt.Fprintf(&b, "Sessions:        %d\n", stats.Sessions)
+	if stats.Sessions == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Total:           %s\n", formatDuration(stats.Total))
+	fmt.Fprintf(&b, "Average:         %s\n", formatDuration(stats.Average))
+	fmt.Fprintf(&b, "Longest:         %s\n", formatDuration(stats.Longest))
+	if stats.PeakViewers > 0 {
+		fmt.Fprintf(&b, "Peak viewers:    %d\n", stats.PeakViewers)
+		fmt.Fprintf(&b, "Average viewers: %d\n", stats.AverageViewers)
+	}
+
+	var most time.Duration
+	for _, hours := range stats.Heatmap {
+		for _, d := range hours {
+			most = max(most, d)
+		}
+	}
+
+	b.WriteString("\nStreaming hours\n    0     6     12    18    \n")
+	// weeks start on Monday
+	for i := range 7 {
+		day := time.Weekday((i + 1) % 7)
+		b.WriteString(day.String()[:3] + " ")
+		for _, d := range stats.Heatmap[day] {
+			shade := 0
+			if d > 0 {
+				shade = 1 + int(float64(d)/float64(most)*float64(len(heatmapShades)-2)+0.5)
+			}
+			b.WriteRune(heatmapShades[min(shade, len(heatmapShades)-1)])
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
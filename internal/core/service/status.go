@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+)
+
+// StatusService reports the current state of the observed streams.
+type StatusService struct {
+	notifications *NotificationService
+	streams       *StreamService
+}
+
+var _ port.StatusReporter = (*StatusService)(nil)
+
+func NewStatusService(notifications *NotificationService, streams *StreamService) *StatusService {
+	return &StatusService{notifications: notifications, streams: streams}
+}
+
+// Streams returns all observed streams ordered by kind, ID and base URL.
+func (s *StatusService) Streams(_ context.Context) []domain.StreamStatus {
+	polls := s.streams.lastStreamPolls()
+
+	statuses := make([]domain.StreamStatus, 0)
+	for query, observed := range s.notifications.observed() {
+		status := domain.StreamStatus{
+			Query:      *query,
+			LatestInfo: observed.LatestInfo,
+			Session:    observed.Session,
+			Observers:  observed.Observers,
+		}
+		if poll, ok := polls[*query]; ok {
+			status.LastPoll = poll.time
+			if poll.err != nil {
+				status.LastError = poll.err.Error()
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i].Query, statuses[j].Query
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.BaseURL < b.BaseURL
+	})
+
+	return statuses
+}
+
+func (s *StatusService) Stream(ctx context.Context,
+	kind domain.StreamKind,
+	id string,
+	baseURL string) (domain.StreamStatus, error) {
+	matches := make([]domain.StreamStatus, 0, 1)
+	for _, status := range s.Streams(ctx) {
+		if status.Query.Kind == kind && strings.EqualFold(status.Query.UserID, id) &&
+			(baseURL == "" || status.Query.BaseURL == baseURL) {
+			matches = append(matches, status)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return domain.StreamStatus{}, fmt.Errorf("stream %s/%s %w", kind, id, domain.ErrNotFound)
+	case 1:
+		return matches[0], nil
+	default:
+		return domain.StreamStatus{}, fmt.Errorf("stream %s/%s is %w, specify the base URL", kind, id,
+			domain.ErrAmbiguous)
+	}
+}
+
+func (s *StatusService) Chat(ctx context.Context, chat domain.Target) ([]domain.StreamStatus, error) {
+	statuses := make([]domain.StreamStatus, 0)
+	for _, status := range s.Streams(ctx) {
+		observers := make([]domain.Observer, 0, 1)
+		for _, observer := range status.Observers {
+			if observer.Observes(chat) {
+				observers = append(observers, observer)
+			}
+		}
+		if len(observers) > 0 {
+			status.Observers = observers
+			statuses = append(statuses, status)
+		}
+	}
+
+	if len(statuses) == 0 {
+		return nil, fmt.Errorf("chat %s %w", chat, domain.ErrNotFound)
+	}
+
+	return statuses, nil
+}
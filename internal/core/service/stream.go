@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
 	"streamobserver/internal/core/domain"
 	"streamobserver/internal/core/port"
 	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -14,12 +18,28 @@ type StreamService struct {
 	twitchGetter       port.StreamInfoProvider
 	restreamerGetter   port.StreamInfoProvider
 	broadcastboxGetter port.StreamInfoProvider
+	metrics            port.Metrics
+
+	mu    sync.Mutex
+	polls map[domain.StreamKind]pollResult
+	// streamPolls is the outcome of the last poll of every stream
+	streamPolls map[domain.StreamQuery]pollResult
+}
+
+// pollResult is the outcome of the last poll of a provider or a stream.
+type pollResult struct {
+	time time.Time
+	err  error
 }
 
 var _ port.StreamInfoService = (*StreamService)(nil)
 
 func NewStreamService(getters ...port.StreamInfoProvider) *StreamService {
-	srv := &StreamService{}
+	srv := &StreamService{
+		metrics:     nopMetrics{},
+		polls:       make(map[domain.StreamKind]pollResult),
+		streamPolls: make(map[domain.StreamQuery]pollResult),
+	}
 
 	for _, getter := range getters {
 		switch getter.Kind() {
@@ -35,6 +55,11 @@ func NewStreamService(getters ...port.StreamInfoProvider) *StreamService {
 	return srv
 }
 
+// SetMetrics records the duration and outcome of every poll of a provider.
+func (ss *StreamService) SetMetrics(metrics port.Metrics) {
+	ss.metrics = metrics
+}
+
 const channelCount = 3
 
 func (ss *StreamService) GetStreamInfos(
@@ -65,6 +90,8 @@ func (ss *StreamService) GetStreamInfos(
 		Int("broadcastboxStreamCount", len(broadcastboxStreams)).
 		Msg("getting stream infos")
 
+	ss.forget(streams)
+
 	wg := new(sync.WaitGroup)
 
 	infoCh := make(chan []domain.StreamInfo, channelCount)
@@ -72,28 +99,27 @@ func (ss *StreamService) GetStreamInfos(
 
 	if len(twitchStreams) > 0 {
 		wg.Add(1)
-		go ss.twitchGetter.GetStreamInfos(ctx, twitchStreams, wg, infoCh, errCh)
+		go ss.poll(ctx, ss.twitchGetter, twitchStreams, wg, infoCh, errCh)
 	}
 
 	if len(restreamerStreams) > 0 {
 		wg.Add(1)
-		go ss.restreamerGetter.GetStreamInfos(ctx, restreamerStreams, wg, infoCh, errCh)
+		go ss.poll(ctx, ss.restreamerGetter, restreamerStreams, wg, infoCh, errCh)
 	}
 
 	if len(broadcastboxStreams) > 0 {
 		wg.Add(1)
-		go ss.broadcastboxGetter.GetStreamInfos(ctx, broadcastboxStreams, wg, infoCh, errCh)
+		go ss.poll(ctx, ss.broadcastboxGetter, broadcastboxStreams, wg, infoCh, errCh)
 	}
 
 	wg.Wait()
 	close(errCh)
 	close(infoCh)
 
+	errs := make([]error, 0)
 	for err := range errCh {
-		if err != nil {
-			log.Error().Err(err).Msg("error getting stream info")
-			return nil, err
-		}
+		log.Error().Err(err).Msg("error getting stream info")
+		errs = append(errs, err)
 	}
 
 	infos := make([]domain.StreamInfo, 0)
@@ -102,5 +128,136 @@ func (ss *StreamService) GetStreamInfos(
 		infos = append(infos, info...)
 	}
 
-	return infos, nil
+	return infos, errors.Join(errs...)
+}
+
+// poll gets the stream infos of a provider, recording the duration and outcome of the poll. The infos of the streams
+// polled successfully are forwarded even if others failed.
+func (ss *StreamService) poll(ctx context.Context,
+	getter port.StreamInfoProvider,
+	streams []*domain.StreamQuery,
+	wg *sync.WaitGroup,
+	infoCh chan<- []domain.StreamInfo,
+	errCh chan<- error) {
+	defer wg.Done()
+
+	start := time.Now()
+	infos, err := fetch(ctx, getter, streams)
+	ss.metrics.ObservePoll(getter.Kind(), time.Since(start), err)
+	ss.record(getter.Kind(), streams, start, err)
+
+	if err != nil {
+		errCh <- fmt.Errorf("error polling %s: %w", getter.Kind(), err)
+	}
+	infoCh <- infos
+}
+
+// fetch gets the stream infos of a provider, the infos of the streams polled successfully are returned even if
+// others failed.
+func fetch(ctx context.Context,
+	getter port.StreamInfoProvider,
+	streams []*domain.StreamQuery) ([]domain.StreamInfo, error) {
+	// providers send their infos, an error for the failed streams or an error failing the batch
+	wg := new(sync.WaitGroup)
+	infoCh := make(chan []domain.StreamInfo, 1)
+	errCh := make(chan error, 1)
+
+	wg.Add(1)
+	getter.GetStreamInfos(ctx, streams, wg, infoCh, errCh)
+	wg.Wait()
+	close(infoCh)
+	close(errCh)
+
+	return <-infoCh, <-errCh
+}
+
+// ProbeStream checks a stream with its provider directly, neither the poll metrics nor the last polls are affected.
+func (ss *StreamService) ProbeStream(ctx context.Context, query domain.StreamQuery) (domain.StreamInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("general.request_timeout"))
+	defer cancel()
+
+	var getter port.StreamInfoProvider
+	switch query.Kind {
+	case domain.StreamKindTwitch:
+		getter = ss.twitchGetter
+	case domain.StreamKindRestreamer:
+		getter = ss.restreamerGetter
+	case domain.StreamKindBroadcastBox:
+		getter = ss.broadcastboxGetter
+	}
+	if getter == nil {
+		return domain.StreamInfo{}, fmt.Errorf("%w: stream kind %q not supported", domain.ErrInvalid, query.Kind)
+	}
+
+	if validator, ok := getter.(port.StreamValidator); ok {
+		err := validator.ValidateStream(ctx, query)
+		if err != nil {
+			return domain.StreamInfo{}, err
+		}
+	}
+
+	infos, err := fetch(ctx, getter, []*domain.StreamQuery{&query})
+	if err != nil {
+		return domain.StreamInfo{}, err
+	}
+	if len(infos) == 0 {
+		return domain.StreamInfo{}, fmt.Errorf("%w: no info for stream %s", domain.ErrNotFound, query.UserID)
+	}
+
+	return infos[0], nil
+}
+
+// record stores the outcome of a poll for the provider and each of its streams.
+func (ss *StreamService) record(kind domain.StreamKind, streams []*domain.StreamQuery, start time.Time, err error) {
+	var failed domain.StreamErrors
+	partial := errors.As(err, &failed)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.polls[kind] = pollResult{time: start, err: err}
+	for _, query := range streams {
+		result := pollResult{time: start, err: err}
+		if partial {
+			result.err = failed[*query]
+		}
+		ss.streamPolls[*query] = result
+	}
+}
+
+// forget drops the poll outcome of streams no longer polled.
+func (ss *StreamService) forget(streams []*domain.StreamQuery) {
+	polled := make(map[domain.StreamQuery]bool, len(streams))
+	for _, query := range streams {
+		polled[*query] = true
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for query := range ss.streamPolls {
+		if !polled[query] {
+			delete(ss.streamPolls, query)
+		}
+	}
+}
+
+// lastPolls returns the outcome of the last poll of every polled provider.
+func (ss *StreamService) lastPolls() map[domain.StreamKind]pollResult {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	polls := make(map[domain.StreamKind]pollResult, len(ss.polls))
+	for kind, result := range ss.polls {
+		polls[kind] = result
+	}
+	return polls
+}
+
+// lastStreamPolls returns the outcome of the last poll of every polled stream.
+func (ss *StreamService) lastStreamPolls() map[domain.StreamQuery]pollResult {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return maps.Clone(ss.streamPolls)
 }
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SubscriptionService manages the observed streams at runtime, persisting them in a port.SubscriptionStore.
+type SubscriptionService struct {
+	store   port.SubscriptionStore
+	broker  port.NotificationBroker
+	streams port.StreamInfoService
+
+	// mu serializes changes to keep the broker and the store in sync
+	mu sync.Mutex
+}
+
+var _ port.SubscriptionManager = (*SubscriptionService)(nil)
+
+func NewSubscriptionService(store port.SubscriptionStore,
+	broker port.NotificationBroker,
+	streams port.StreamInfoService) *SubscriptionService {
+	return &SubscriptionService{store: store, broker: broker, streams: streams}
+}
+
+// Load seeds the store with the configured subscriptions on first start and registers all stored subscriptions.
+func (s *SubscriptionService) Load(ctx context.Context, seed []domain.Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seeded, err := s.store.Seed(ctx, seed)
+	if err != nil {
+		return err
+	}
+	if seeded {
+		log.Info().Int("count", len(seed)).Msg("seeded subscriptions from config")
+	}
+
+	subscriptions, err := s.store.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		query := subscription.Query
+		err = s.broker.Register(subscription.Target, &query, subscription.OfflinePolicy)
+		if err != nil {
+			// a notifier may have been removed from the config since
+			log.Err(err).Stringer("target", subscription.Target).Str("stream", query.UserID).
+				Msg("failed to register stored subscription, skipping")
+		}
+	}
+
+	log.Info().Int("count", len(subscriptions)).Msg("loaded subscriptions")
+
+	return nil
+}
+
+func (s *SubscriptionService) Subscribe(ctx context.Context, subscription domain.Subscription) error {
+	query := subscription.Query
+	if query.UserID == "" {
+		return fmt.Errorf("%w: stream id missing", domain.ErrInvalid)
+	}
+	if (query.Kind == domain.StreamKindRestreamer || query.Kind == domain.StreamKindBroadcastBox) &&
+		query.BaseURL == "" {
+		return fmt.Errorf("%w: base url of %s stream missing", domain.ErrInvalid, query.Kind)
+	}
+
+	_, err := s.streams.ProbeStream(ctx, query)
+	if errors.Is(err, domain.ErrInvalid) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: error probing stream %s/%s: %w", domain.ErrInvalid, query.Kind, query.UserID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.broker.Register(subscription.Target, &query, subscription.OfflinePolicy)
+	if err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrInvalid, err)
+	}
+
+	err = s.store.AddSubscription(ctx, subscription)
+	if err != nil {
+		_ = s.broker.Unregister(subscription.Target, query)
+		return err
+	}
+
+	return nil
+}
+
+func (s *SubscriptionService) Unsubscribe(ctx context.Context, target domain.Target, query domain.StreamQuery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.store.RemoveSubscription(ctx, target, query)
+	if err != nil {
+		return err
+	}
+
+	err = s.broker.Unregister(target, query)
+	if err != nil {
+		log.Warn().Err(err).Stringer("target", target).Str("stream", query.UserID).
+			Msg("removed subscription was not observed")
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate renders the classic message with the stream status in brackets.
+const DefaultTemplate = `{{ if .IsOnline }}{{ tr "is_streaming" .Username .Title }}` +
+	`{{ else }}{{ tr "was_streaming" .Username .Title }}{{ end }}` +
+	`{{ if ge .ViewerCount 0 }} {{ plural "viewers" .ViewerCount }}{{ end }}` +
+	`{{ with .Session }}{{ if not $.IsOnline }}
+{{ tr "session_duration" (duration .Duration) }}` +
+	`{{ if .Samples }}, {{ plural "peak_viewers" .PeakViewers }}{{ end }}{{ end }}{{ end }}
+{{ .URL }}
+{{ esc "[" }}{{ if .IsOnline }}{{ tr "live" }}{{ else }}{{ tr "offline" }}{{ end }}{{ esc "]" }}`
+
+// DigestTemplate renders the digest with a line per stream.
+const DigestTemplate = `{{ tr "digest_title" }}
+{{ range .Streams }}
+{{ .Username }}: {{ if .Sessions }}{{ plural "digest_streams" .Sessions }}, {{ tr "digest_live" (duration .Live) }}` +
+	`{{ if .PeakViewers }}, {{ plural "peak_viewers" .PeakViewers }}{{ end }}` +
+	`{{ if .Category }}, {{ tr "digest_category" .Category }}{{ end }}` +
+	`{{ else }}{{ tr "digest_no_streams" }}{{ end }}{{ end }}`
+
+// TemplateService renders messages from text/templates, resolving the template of a stream before the template of
+// a target before the global template. Messages are translated to the locale of the target.
+type TemplateService struct {
+	global  *template.Template
+	digest  *template.Template
+	catalog *Catalog
+	locale  *Locale
+
+	mu      sync.RWMutex
+	targets map[domain.Target]*template.Template
+	streams map[streamTemplateKey]*template.Template
+	locales map[domain.Target]*Locale
+}
+
+var _ port.MessageRenderer = (*TemplateService)(nil)
+
+type streamTemplateKey struct {
+	target domain.Target
+	query  domain.StreamQuery
+}
+
+// templateFuncs are the helpers available in message templates, the helpers esc, tr, plural and number are bound
+// to the locale and markup of the target when rendering.
+var templateFuncs = template.FuncMap{
+	"duration":       formatDuration,
+	"esc":            noEscape,
+	"tr":             func(key string, _ ...any) string { return key },
+	"plural":         func(key string, _ int, _ ...any) string { return key },
+	"number":         strconv.Itoa,
+	"escapeHTML":     html.EscapeString,
+	"escapeMarkdown": domain.EscapeMarkdownV2,
+	"truncate":       truncate,
+	"upper":          strings.ToUpper,
+	"lower":          strings.ToLower,
+}
+
+// NewTemplateService validates the global template and locale, DefaultTemplate is used if the template is empty.
+func NewTemplateService(global string, catalog *Catalog, locale string) (*TemplateService, error) {
+	if global == "" {
+		global = DefaultTemplate
+	}
+
+	t, err := parseTemplate("global", global)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := catalog.Get(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := template.New("digest").Funcs(templateFuncs).Parse(DigestTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest template: %w", err)
+	}
+
+	return &TemplateService{
+		global:  t,
+		digest:  digest,
+		catalog: catalog,
+		locale:  l,
+		targets: make(map[domain.Target]*template.Template),
+		streams: make(map[streamTemplateKey]*template.Template),
+		locales: make(map[domain.Target]*Locale),
+	}, nil
+}
+
+// SetTargetLocale sets the locale of the messages notified to a target.
+func (ts *TemplateService) SetTargetLocale(target domain.Target, locale string) error {
+	l, err := ts.catalog.Get(locale)
+	if err != nil {
+		return fmt.Errorf("invalid locale for %s: %w", target, err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.locales[target] = l
+
+	return nil
+}
+
+// SetTargetTemplate validates and sets the template of all streams notified to a target.
+func (ts *TemplateService) SetTargetTemplate(target domain.Target, text string) error {
+	t, err := parseTemplate(target.String(), text)
+	if err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.targets[target] = t
+
+	return nil
+}
+
+// SetStreamTemplate validates and sets the template of a single stream notified to a target.
+func (ts *TemplateService) SetStreamTemplate(target domain.Target, query domain.StreamQuery, text string) error {
+	t, err := parseTemplate(target.String()+" "+string(query.Kind)+"/"+query.UserID, text)
+	if err != nil {
+		return err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.streams[streamTemplateKey{target: target, query: query}] = t
+
+	return nil
+}
+
+// Render executes the template of a stream for a target. If escape is set, it is applied to the text fields of
+// the stream and the output of the locale helpers, leaving the markup of the template itself untouched.
+func (ts *TemplateService) Render(target domain.Target,
+	stream domain.StreamInfo,
+	escape func(string) string) (string, error) {
+	t, l := ts.lookup(target, stream.Query)
+
+	if escape == nil {
+		escape = noEscape
+	}
+	stream.Username = escape(stream.Username)
+	stream.Title = escape(stream.Title)
+	stream.Category = escape(stream.Category)
+	stream.URL = escape(stream.URL)
+	stream.VODURL = escape(stream.VODURL)
+	stream.ThumbnailURL = escape(stream.ThumbnailURL)
+	if stream.Session != nil {
+		stream.Session = stream.Session.Clone()
+		for i, change := range stream.Session.Changes {
+			stream.Session.Changes[i].Title = escape(change.Title)
+			stream.Session.Changes[i].Category = escape(change.Category)
+		}
+	}
+
+	// templates are shared between targets, the locale helpers are bound to a copy
+	clone, err := t.Clone()
+	if err != nil {
+		return "", fmt.Errorf("error copying template %s: %w", t.Name(), err)
+	}
+
+	text := new(strings.Builder)
+	err = clone.Funcs(l.funcs(escape)).Execute(text, stream)
+	if err != nil {
+		return "", fmt.Errorf("error rendering template %s: %w", t.Name(), err)
+	}
+
+	return strings.TrimSpace(text.String()), nil
+}
+
+// RenderDigest executes the digest template for a target, escaping like Render.
+func (ts *TemplateService) RenderDigest(target domain.Target,
+	digest domain.Digest,
+	escape func(string) string) (string, error) {
+	_, l := ts.lookup(target, nil)
+
+	if escape == nil {
+		escape = noEscape
+	}
+	streams := make([]domain.DigestEntry, len(digest.Streams))
+	for i, entry := range digest.Streams {
+		entry.Username = escape(entry.Username)
+		entry.Category = escape(entry.Category)
+		streams[i] = entry
+	}
+	digest.Streams = streams
+
+	clone, err := ts.digest.Clone()
+	if err != nil {
+		return "", fmt.Errorf("error copying digest template: %w", err)
+	}
+
+	text := new(strings.Builder)
+	err = clone.Funcs(l.funcs(escape)).Execute(text, digest)
+	if err != nil {
+		return "", fmt.Errorf("error rendering digest template: %w", err)
+	}
+
+	return strings.TrimSpace(text.String()), nil
+}
+
+// Translate returns a message in the locale of a target.
+func (ts *TemplateService) Translate(target domain.Target, key string) string {
+	_, l := ts.lookup(target, nil)
+	return l.Translate(key)
+}
+
+func (ts *TemplateService) lookup(target domain.Target, query *domain.StreamQuery) (*template.Template, *Locale) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	l, ok := ts.locales[target]
+	if !ok {
+		l = ts.locale
+	}
+
+	if query != nil {
+		if t, ok := ts.streams[streamTemplateKey{target: target, query: *query}]; ok {
+			return t, l
+		}
+	}
+	if t, ok := ts.targets[target]; ok {
+		return t, l
+	}
+
+	return ts.global, l
+}
+
+// parseTemplate parses a template and executes it with sample data, catching unknown fields and functions at startup.
+func parseTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %s: %w", name, err)
+	}
+
+	sample := domain.StreamInfo{
+		Query:        &domain.StreamQuery{UserID: "sample", Kind: domain.StreamKindTwitch},
+		Username:     "sample",
+		Title:        "Sample stream",
+		Category:     "Sample category",
+		URL:          "https://example.tld/sample",
+		ViewerCount:  42,
+		ThumbnailURL: "https://example.tld/sample.jpg",
+		StartedAt:    time.Now().Add(-time.Hour),
+		Session: &domain.Session{
+			StartedAt:   time.Now().Add(-time.Hour),
+			PeakViewers: 64,
+			ViewerSum:   84,
+			Samples:     2,
+			Changes:     []domain.SessionChange{{Time: time.Now(), Title: "Sample stream", Category: "Sample category"}},
+		},
+	}
+
+	for _, online := range []bool{true, false} {
+		sample.IsOnline = online
+		if !online {
+			sample.Session.EndedAt = time.Now()
+		}
+		err = t.Execute(new(strings.Builder), sample)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %w", name, err)
+		}
+	}
+
+	return t, nil
+}
+
+// formatDuration formats a duration as hours and minutes, e.g. "3h12m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+
+	if hours == 0 {
+		return strconv.Itoa(minutes) + "m"
+	}
+	return fmt.Sprintf("%dh%02dm", hours, minutes)
+}
+
+// truncate shortens a text to a maximum number of runes, adding an ellipsis.
+func truncate(length int, text string) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:max(length-1, 0)]) + "…"
+}
@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strconv"
 	"streamobserver/internal/adapter/broadcastbox"
 	"streamobserver/internal/adapter/restreamer"
-	"streamobserver/internal/adapter/telegram"
 	"streamobserver/internal/adapter/twitch"
 	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
 	"streamobserver/internal/core/service"
+	"strings"
+	"time"
 
-	"github.com/go-telegram/bot"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -18,7 +22,6 @@ import (
 func main() {
 	log.Info().Str("author", "davidramiro").Msg("starting streamobserver")
 
-	log.Info().Msg("initializing telegram bot")
 	viper.AddConfigPath(".")
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -31,52 +34,299 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 
-	token := viper.GetString("telegram.apikey")
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		err = runStats(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	catalog, err := service.LoadCatalog(viper.GetString("general.locale_dir"))
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to load locales")
+	}
+
+	templates, err := service.NewTemplateService(viper.GetString("general.template"), catalog,
+		viper.GetString("general.locale"))
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to initialize templates")
+	}
 
-	b, err := bot.New(token)
+	var chats []domain.ChatConfig
+	err = viper.UnmarshalKey("chats", &chats)
 	if err != nil {
-		log.Panic().Err(err).Msg("failed initializing telegram bot")
+		log.Panic().Err(err).Msg("failed to unmarshal config")
+	}
+
+	store, stats := setupStats()
+
+	var reporter port.StatsReporter
+	if stats != nil {
+		reporter = stats
 	}
+	notifiers := setupNotifiers(templates, chats, reporter)
 
-	sender := telegram.NewTelegramSender(b)
 	ta := &twitch.StreamInfoProvider{}
 	ra := &restreamer.StreamInfoProvider{}
 	bb := &broadcastbox.StreamInfoProvider{}
 
 	streamService := service.NewStreamService(ta, ra, bb)
 
-	notificationService := service.NewNotificationService(sender, streamService)
+	notificationService := service.NewNotificationService(streamService, notifiers...)
 
-	var chats []domain.ChatConfig
-	err = viper.UnmarshalKey("chats", &chats)
+	server := setupServer()
+	metrics := setupMetrics(server)
+	if metrics != nil {
+		ta.Metrics = metrics
+		ra.Metrics = metrics
+		bb.Metrics = metrics
+		streamService.SetMetrics(metrics)
+		notificationService.SetMetrics(metrics)
+	}
+
+	if store != nil {
+		notificationService.SetSessionStore(store)
+	}
+
+	digest := setupDigest(notificationService, notifiers, chats)
+	if digest != nil {
+		notificationService.AddSessionListener(digest)
+		if store != nil {
+			digest.SetSessionStore(store)
+		}
+	}
+
+	seed := make([]domain.Subscription, 0)
+	for _, chat := range chats {
+		targets, err := chatTargets(chat)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to parse chat targets")
+		}
+
+		policy, err := domain.ParseOfflinePolicy(chat.Offline)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to parse chat offline policy")
+		}
+
+		for _, stream := range chatStreams(chat) {
+			for _, target := range targets {
+				target = topicTarget(target, chat.Topic, stream.topic)
+
+				err = setupTarget(templates, chat, target)
+				if err != nil {
+					log.Panic().Err(err).Msg("failed to set up chat")
+				}
+
+				if stream.template != "" {
+					err = templates.SetStreamTemplate(target, *stream.query, stream.template)
+					if err != nil {
+						log.Panic().Err(err).Msg("failed to parse stream template")
+					}
+				}
+
+				seed = append(seed, domain.Subscription{
+					Target:        target,
+					Query:         *stream.query,
+					OfflinePolicy: policy,
+				})
+			}
+		}
+	}
+
+	subscriptions := setupSubscriptions(server, notificationService, streamService)
+	if subscriptions != nil {
+		err = subscriptions.Load(context.Background(), seed)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to load subscriptions")
+		}
+	} else {
+		for _, subscription := range seed {
+			err = notificationService.Register(subscription.Target, &subscription.Query, subscription.OfflinePolicy)
+			if err != nil {
+				log.Panic().Err(err).Msg("failed to register stream")
+			}
+		}
+	}
+
+	if digest != nil {
+		digest.Start()
+	}
+
+	if server != nil {
+		setupHealth(server, notificationService, streamService, notifiers, ta)
+		setupAPI(server, notificationService, streamService, subscriptions)
+		server.Start()
+	}
+
+	notificationService.StartPolling(context.Background())
+}
+
+// setupDigest creates the digest scheduler if enabled in the config and registers the chats opting in, nil otherwise.
+func setupDigest(notifications *service.NotificationService,
+	notifiers []port.Notifier,
+	chats []domain.ChatConfig) *service.DigestService {
+	if !viper.IsSet("digest") {
+		return nil
+	}
+
+	location := time.Local
+	if tz := viper.GetString("digest.timezone"); tz != "" {
+		var err error
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			log.Panic().Err(err).Msg("invalid digest timezone")
+		}
+	}
+
+	viper.SetDefault("digest.schedule", "0 9 * * 1")
+	digest, err := service.NewDigestService(notifications, viper.GetString("digest.schedule"), location,
+		notifiers...)
 	if err != nil {
-		log.Panic().Err(err).Msg("failed to unmarshal config")
+		log.Panic().Err(err).Msg("failed to initialize digest")
 	}
 
 	for _, chat := range chats {
-		for _, restreamerConfig := range chat.Streams.Restreamer {
-			notificationService.Register(chat.ChatID, &domain.StreamQuery{
+		if !chat.Digest {
+			continue
+		}
+
+		targets, err := chatTargets(chat)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to parse chat targets")
+		}
+		for i, target := range targets {
+			targets[i] = topicTarget(target, chat.Topic, "")
+		}
+
+		queries := make([]*domain.StreamQuery, 0)
+		for _, stream := range chatStreams(chat) {
+			queries = append(queries, stream.query)
+		}
+
+		err = digest.AddChat(targets, queries)
+		if err != nil {
+			log.Panic().Err(err).Int64("chat", chat.ChatID).Msg("failed to enable digest for chat")
+		}
+	}
+
+	return digest
+}
+
+// chatTargets collects the Telegram chat ID and additional notification targets of a chat.
+func chatTargets(chat domain.ChatConfig) ([]domain.Target, error) {
+	targets := make([]domain.Target, 0, len(chat.Targets)+1)
+
+	if chat.ChatID != 0 {
+		targets = append(targets, domain.Target{
+			Kind: domain.NotifierKindTelegram,
+			ID:   strconv.FormatInt(chat.ChatID, 10),
+		})
+	}
+
+	for _, t := range chat.Targets {
+		target, err := domain.ParseTarget(t)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// setupTarget applies the locale and template of a chat to one of its targets.
+func setupTarget(templates *service.TemplateService, chat domain.ChatConfig, target domain.Target) error {
+	if chat.Locale != "" {
+		err := templates.SetTargetLocale(target, chat.Locale)
+		if err != nil {
+			return err
+		}
+	}
+
+	if chat.Template != "" {
+		err := templates.SetTargetTemplate(target, chat.Template)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// topicTarget routes a Telegram target into the forum topic of a stream or chat, the stream topic takes precedence.
+// Targets already addressing a topic are kept.
+func topicTarget(target domain.Target, chatTopic string, streamTopic string) domain.Target {
+	if target.Kind != domain.NotifierKindTelegram || strings.Contains(target.ID, "/") {
+		return target
+	}
+
+	topic := streamTopic
+	if topic == "" {
+		topic = chatTopic
+	}
+	if topic != "" {
+		target.ID += "/" + topic
+	}
+
+	return target
+}
+
+// chatStream is a stream observed by a chat with its optional message template, forum topic and link button.
+type chatStream struct {
+	query    *domain.StreamQuery
+	template string
+	topic    string
+	// buttonURL and buttonText are the optional secondary link button of Telegram messages
+	buttonURL  string
+	buttonText string
+}
+
+// chatStreams builds the stream queries of all services observed by a chat.
+func chatStreams(chat domain.ChatConfig) []chatStream {
+	streams := make([]chatStream, 0)
+
+	for _, restreamerConfig := range chat.Streams.Restreamer {
+		streams = append(streams, chatStream{
+			query: &domain.StreamQuery{
 				UserID:    restreamerConfig.ID,
 				BaseURL:   restreamerConfig.BaseURL,
 				CustomURL: restreamerConfig.CustomURL,
 				Kind:      domain.StreamKindRestreamer,
-			})
-		}
-		for _, twitchConfig := range chat.Streams.Twitch {
-			notificationService.Register(chat.ChatID, &domain.StreamQuery{
+			},
+			template:   restreamerConfig.Template,
+			topic:      restreamerConfig.Topic,
+			buttonURL:  restreamerConfig.ButtonURL,
+			buttonText: restreamerConfig.ButtonText,
+		})
+	}
+	for _, twitchConfig := range chat.Streams.Twitch {
+		streams = append(streams, chatStream{
+			query: &domain.StreamQuery{
 				UserID: twitchConfig.Username,
 				Kind:   domain.StreamKindTwitch,
-			})
-		}
-		for _, broadcastboxConfig := range chat.Streams.BroadcastBox {
-			notificationService.Register(chat.ChatID, &domain.StreamQuery{
+			},
+			template:   twitchConfig.Template,
+			topic:      twitchConfig.Topic,
+			buttonURL:  twitchConfig.ButtonURL,
+			buttonText: twitchConfig.ButtonText,
+		})
+	}
+	for _, broadcastboxConfig := range chat.Streams.BroadcastBox {
+		streams = append(streams, chatStream{
+			query: &domain.StreamQuery{
 				UserID:    broadcastboxConfig.ID,
 				BaseURL:   broadcastboxConfig.BaseURL,
 				CustomURL: broadcastboxConfig.CustomURL,
 				Kind:      domain.StreamKindBroadcastBox,
-			})
-		}
+			},
+			template:   broadcastboxConfig.Template,
+			topic:      broadcastboxConfig.Topic,
+			buttonURL:  broadcastboxConfig.ButtonURL,
+			buttonText: broadcastboxConfig.ButtonText,
+		})
 	}
 
-	notificationService.StartPolling(context.Background())
+	return streams
 }
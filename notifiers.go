@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"streamobserver/internal/adapter/bluesky"
+	"streamobserver/internal/adapter/email"
+	"streamobserver/internal/adapter/gotify"
+	"streamobserver/internal/adapter/irc"
+	"streamobserver/internal/adapter/mastodon"
+	"streamobserver/internal/adapter/mqtt"
+	"streamobserver/internal/adapter/ntfy"
+	"streamobserver/internal/adapter/slack"
+	"streamobserver/internal/adapter/telegram"
+	"streamobserver/internal/adapter/webhook"
+	"streamobserver/internal/adapter/xmpp"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// setupNotifiers initializes a notifier for every notification service present in the config.
+func setupNotifiers(renderer port.MessageRenderer,
+	chats []domain.ChatConfig,
+	stats port.StatsReporter) []port.Notifier {
+	notifiers := make([]port.Notifier, 0)
+
+	if viper.IsSet("telegram.apikey") {
+		log.Info().Msg("initializing telegram bot")
+		// updates are only received for commands, without a handler they are ignored
+		b, err := bot.New(viper.GetString("telegram.apikey"),
+			bot.WithDefaultHandler(func(context.Context, *bot.Bot, *models.Update) {}))
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing telegram bot")
+		}
+		viper.SetDefault("telegram.buttons", true)
+		viper.SetDefault("telegram.commands", true)
+		t, err := telegram.NewTelegramSender(b, renderer, telegram.Config{
+			ParseMode:        viper.GetString("telegram.parse_mode"),
+			Buttons:          viper.GetBool("telegram.buttons"),
+			TopicsFile:       viper.GetString("telegram.topics_file"),
+			Pins:             telegramPins(chats),
+			Links:            telegramLinks(chats),
+			ThumbnailRefresh: viper.GetDuration("telegram.thumbnail_refresh"),
+			GlobalRate:       viper.GetFloat64("telegram.rate_limit.global"),
+			GroupRate:        viper.GetFloat64("telegram.rate_limit.group"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing telegram sender")
+		}
+		if stats != nil && viper.GetBool("telegram.commands") {
+			t.HandleStats(stats, telegramChats(chats))
+		}
+		notifiers = append(notifiers, t)
+	}
+
+	if viper.IsSet("webhooks") {
+		log.Info().Msg("initializing webhooks")
+		wh, err := webhook.NewWebhookSender(webhookConfigs())
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing webhooks")
+		}
+		notifiers = append(notifiers, wh)
+	}
+
+	if viper.IsSet("ntfy") {
+		log.Info().Msg("initializing ntfy")
+		n, err := ntfy.NewNtfySender(ntfy.Config{
+			Server:        viper.GetString("ntfy.server"),
+			Token:         viper.GetString("ntfy.token"),
+			Priority:      viper.GetInt("ntfy.priority"),
+			Tags:          viper.GetStringSlice("ntfy.tags"),
+			OfflineNotice: viper.GetBool("ntfy.offline_notice"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing ntfy")
+		}
+		notifiers = append(notifiers, n)
+	}
+
+	if viper.IsSet("gotify") {
+		log.Info().Msg("initializing gotify")
+		g, err := gotify.NewGotifySender(gotify.Config{
+			Server:        viper.GetString("gotify.server"),
+			Applications:  viper.GetStringMapString("gotify.applications"),
+			Priority:      viper.GetInt("gotify.priority"),
+			Markdown:      viper.GetBool("gotify.markdown"),
+			OfflineNotice: viper.GetBool("gotify.offline_notice"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing gotify")
+		}
+		notifiers = append(notifiers, g)
+	}
+
+	if viper.IsSet("email") {
+		log.Info().Msg("initializing email")
+		e, err := email.NewEmailSender(email.Config{
+			Host:        viper.GetString("email.host"),
+			Port:        viper.GetInt("email.port"),
+			Username:    viper.GetString("email.username"),
+			Password:    viper.GetString("email.password"),
+			From:        viper.GetString("email.from"),
+			Security:    viper.GetString("email.security"),
+			OfflineMail: viper.GetBool("email.offline_mail"),
+			BatchWindow: viper.GetDuration("email.batch_window"),
+			Timeout:     viper.GetDuration("general.request_timeout"),
+			TemplateDir: viper.GetString("email.template_dir"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing email")
+		}
+		notifiers = append(notifiers, e)
+	}
+
+	if viper.IsSet("slack") {
+		log.Info().Msg("initializing slack")
+		viper.SetDefault("slack.max_retries", slack.DefaultMaxRetries)
+		sl, err := slack.NewSlackSender(slack.Config{
+			Token:      viper.GetString("slack.token"),
+			MaxRetries: viper.GetInt("slack.max_retries"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing slack")
+		}
+		notifiers = append(notifiers, sl)
+	}
+
+	if viper.IsSet("mastodon") {
+		log.Info().Msg("initializing mastodon")
+		m, err := mastodon.NewMastodonSender(mastodonAccounts())
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing mastodon")
+		}
+		notifiers = append(notifiers, m)
+	}
+
+	if viper.IsSet("bluesky") {
+		log.Info().Msg("initializing bluesky")
+		bs, err := bluesky.NewBlueskySender(blueskyAccounts())
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing bluesky")
+		}
+		notifiers = append(notifiers, bs)
+	}
+
+	if viper.IsSet("irc") {
+		log.Info().Msg("initializing irc")
+		i, err := irc.NewIRCSender(irc.Config{
+			Server:           viper.GetString("irc.server"),
+			TLS:              viper.GetBool("irc.tls"),
+			Nick:             viper.GetString("irc.nick"),
+			User:             viper.GetString("irc.user"),
+			RealName:         viper.GetString("irc.realname"),
+			SASLUser:         viper.GetString("irc.sasl_user"),
+			SASLPassword:     viper.GetString("irc.sasl_password"),
+			NickServPassword: viper.GetString("irc.nickserv_password"),
+			Channels:         viper.GetStringSlice("irc.channels"),
+			FloodBurst:       viper.GetInt("irc.flood_burst"),
+			FloodInterval:    viper.GetDuration("irc.flood_interval"),
+			LiveFormat:       viper.GetString("irc.format.live"),
+			OfflineFormat:    viper.GetString("irc.format.offline"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing irc")
+		}
+		notifiers = append(notifiers, i)
+	}
+
+	if viper.IsSet("xmpp") {
+		log.Info().Msg("initializing xmpp")
+		x, err := xmpp.NewXMPPSender(xmpp.Config{
+			JID:           viper.GetString("xmpp.jid"),
+			Password:      viper.GetString("xmpp.password"),
+			Server:        viper.GetString("xmpp.server"),
+			DirectTLS:     viper.GetBool("xmpp.direct_tls"),
+			Nick:          viper.GetString("xmpp.nick"),
+			Rooms:         viper.GetStringSlice("xmpp.rooms"),
+			LiveFormat:    viper.GetString("xmpp.format.live"),
+			OfflineFormat: viper.GetString("xmpp.format.offline"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing xmpp")
+		}
+		notifiers = append(notifiers, x)
+	}
+
+	if viper.IsSet("mqtt") {
+		log.Info().Msg("initializing mqtt")
+		m, err := mqtt.NewMQTTSender(mqtt.Config{
+			Broker:          viper.GetString("mqtt.broker"),
+			ClientID:        viper.GetString("mqtt.client_id"),
+			Username:        viper.GetString("mqtt.username"),
+			Password:        viper.GetString("mqtt.password"),
+			StatusTopic:     viper.GetString("mqtt.status_topic"),
+			Discovery:       viper.GetBool("mqtt.discovery.enabled"),
+			DiscoveryPrefix: viper.GetString("mqtt.discovery.prefix"),
+		})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed initializing mqtt")
+		}
+		notifiers = append(notifiers, m)
+	}
+
+	return notifiers
+}
+
+// telegramPins collects the pin modes of the Telegram chats.
+func telegramPins(chats []domain.ChatConfig) map[int64]string {
+	pins := make(map[int64]string)
+
+	for _, chat := range chats {
+		if chat.Pin == "" {
+			continue
+		}
+		for _, chatID := range telegramChatIDs(chat) {
+			pins[chatID] = chat.Pin
+		}
+	}
+
+	return pins
+}
+
+// telegramLinks collects the secondary link buttons configured per stream.
+func telegramLinks(chats []domain.ChatConfig) map[domain.StreamQuery]telegram.Link {
+	links := make(map[domain.StreamQuery]telegram.Link)
+
+	for _, chat := range chats {
+		for _, stream := range chatStreams(chat) {
+			if stream.buttonURL != "" {
+				links[*stream.query] = telegram.Link{URL: stream.buttonURL, Text: stream.buttonText}
+			}
+		}
+	}
+
+	return links
+}
+
+// telegramChats collects the IDs of all Telegram chats.
+func telegramChats(chats []domain.ChatConfig) []int64 {
+	ids := make([]int64, 0, len(chats))
+
+	for _, chat := range chats {
+		ids = append(ids, telegramChatIDs(chat)...)
+	}
+
+	return ids
+}
+
+// telegramChatIDs returns the Telegram chat IDs among the targets of a chat.
+func telegramChatIDs(chat domain.ChatConfig) []int64 {
+	targets, err := chatTargets(chat)
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to parse chat targets")
+	}
+
+	ids := make([]int64, 0, len(targets))
+	for _, target := range targets {
+		if target.Kind != domain.NotifierKindTelegram {
+			continue
+		}
+
+		id, _, _ := strings.Cut(target.ID, "/")
+		chatID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			log.Panic().Err(err).Str("target", target.String()).Msg("invalid telegram chat id")
+		}
+		ids = append(ids, chatID)
+	}
+
+	return ids
+}
+
+// webhookConfigs reads the named webhook endpoints.
+func webhookConfigs() map[string]webhook.Config {
+	configs := make(map[string]webhook.Config)
+
+	for name := range viper.GetStringMap("webhooks") {
+		sub := viper.Sub("webhooks." + name)
+		sub.SetDefault("retries", webhook.DefaultRetries)
+		sub.SetDefault("backoff", webhook.DefaultBackoff)
+
+		configs[name] = webhook.Config{
+			URL:       sub.GetString("url"),
+			Headers:   sub.GetStringMapString("headers"),
+			Secret:    sub.GetString("secret"),
+			IDField:   sub.GetString("id_field"),
+			Templates: sub.GetStringMapString("templates"),
+			Retries:   sub.GetInt("retries"),
+			Backoff:   sub.GetDuration("backoff"),
+		}
+	}
+
+	return configs
+}
+
+// mastodonAccounts reads the named Mastodon accounts.
+func mastodonAccounts() map[string]mastodon.Account {
+	accounts := make(map[string]mastodon.Account)
+
+	for name := range viper.GetStringMap("mastodon") {
+		sub := viper.Sub("mastodon." + name)
+		accounts[name] = mastodon.Account{
+			Server:          sub.GetString("server"),
+			Token:           sub.GetString("token"),
+			Visibility:      sub.GetString("visibility"),
+			Language:        sub.GetString("language"),
+			AttachThumbnail: sub.GetBool("attach_thumbnail"),
+		}
+	}
+
+	return accounts
+}
+
+// blueskyAccounts reads the named Bluesky accounts.
+func blueskyAccounts() map[string]bluesky.Account {
+	accounts := make(map[string]bluesky.Account)
+
+	for name := range viper.GetStringMap("bluesky") {
+		sub := viper.Sub("bluesky." + name)
+		accounts[name] = bluesky.Account{
+			Server:     sub.GetString("server"),
+			Identifier: sub.GetString("identifier"),
+			Password:   sub.GetString("password"),
+			Language:   sub.GetString("language"),
+			Embed:      sub.GetString("embed"),
+		}
+	}
+
+	return accounts
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"streamobserver/internal/adapter/httpserver"
+	"streamobserver/internal/adapter/prometheus"
+	"streamobserver/internal/adapter/sqlite"
+	"streamobserver/internal/core/domain"
+	"streamobserver/internal/core/port"
+	"streamobserver/internal/core/service"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// setupServer creates the HTTP server if an address is configured, nil otherwise.
+func setupServer() *httpserver.Server {
+	viper.SetDefault("http.metrics", true)
+	viper.SetDefault("http.api", true)
+	viper.SetDefault("http.dashboard", true)
+
+	addr := viper.GetString("http.listen")
+	if addr == "" {
+		return nil
+	}
+	return httpserver.NewServer(addr)
+}
+
+// setupMetrics serves the Prometheus metrics if the HTTP server and metrics are enabled, nil otherwise.
+func setupMetrics(server *httpserver.Server) *prometheus.Metrics {
+	if server == nil || !viper.GetBool("http.metrics") {
+		return nil
+	}
+
+	metrics := prometheus.NewMetrics()
+	server.Handle("GET /metrics", metrics.Handler())
+
+	return metrics
+}
+
+// setupHealth serves the liveness and readiness probes, checking every notifier able to and the twitch token if
+// twitch streams are observed.
+func setupHealth(server *httpserver.Server,
+	notificationService *service.NotificationService,
+	streamService *service.StreamService,
+	notifiers []port.Notifier,
+	twitch port.HealthChecker) {
+	health := service.NewHealthService(notificationService, streamService,
+		viper.GetDuration("general.polling_interval"))
+
+	for _, notifier := range notifiers {
+		if checker, ok := notifier.(port.HealthChecker); ok {
+			health.AddCheck(string(notifier.Kind()), checker)
+		}
+	}
+
+	// streams may be subscribed at runtime, the credentials are checked as soon as they are configured
+	if viper.IsSet("twitch.client_id") {
+		health.AddCheck(string(domain.StreamKindTwitch), twitch)
+	}
+
+	server.HandleHealth(health)
+}
+
+// setupAPI serves the state of the observed streams if enabled, protected by the bearer token if configured, with the
+// dashboard and the management of the subscriptions if enabled.
+func setupAPI(server *httpserver.Server,
+	notificationService *service.NotificationService,
+	streamService *service.StreamService,
+	subscriptions *service.SubscriptionService) {
+	if !viper.GetBool("http.api") {
+		return
+	}
+
+	token := viper.GetString("http.token")
+	if token == "" {
+		log.Warn().Msg("http api enabled without token, stream state and chat IDs are readable by anyone")
+	}
+
+	status := service.NewStatusService(notificationService, streamService)
+	server.HandleAPI(status, token)
+
+	if viper.GetBool("http.dashboard") {
+		dashboard := httpserver.NewDashboard(status)
+		server.HandleDashboard(dashboard, token)
+		notificationService.AddChangeListener(dashboard)
+	}
+
+	if subscriptions != nil {
+		server.HandleSubscriptions(subscriptions, token)
+	}
+}
+
+// setupSubscriptions opens the subscription database if enabled in the config, nil otherwise. Managing the
+// subscriptions requires the API with a token.
+func setupSubscriptions(server *httpserver.Server,
+	notificationService *service.NotificationService,
+	streamService *service.StreamService) *service.SubscriptionService {
+	if !viper.IsSet("subscriptions") {
+		return nil
+	}
+
+	if server == nil || !viper.GetBool("http.api") || viper.GetString("http.token") == "" {
+		log.Panic().Msg("subscriptions require http.listen, http.api and http.token")
+	}
+
+	store, err := sqlite.NewSubscriptionStore(viper.GetString("subscriptions.database"))
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to open subscription database")
+	}
+
+	return service.NewSubscriptionService(store, notificationService, streamService)
+}
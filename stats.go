@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"streamobserver/internal/adapter/sqlite"
+	"streamobserver/internal/core/service"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// setupStats opens the session database and the statistics if enabled in the config, both are nil otherwise.
+func setupStats() (*sqlite.SessionStore, *service.StatsService) {
+	if !viper.IsSet("stats") {
+		return nil, nil
+	}
+
+	location := time.Local
+	if tz := viper.GetString("stats.timezone"); tz != "" {
+		var err error
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			log.Panic().Err(err).Msg("invalid stats timezone")
+		}
+	}
+
+	store, err := sqlite.NewSessionStore(viper.GetString("stats.database"))
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to open session database")
+	}
+
+	return store, service.NewStatsService(store, location)
+}
+
+// runStats prints the statistics of the given or all recorded streams, usage: stats [-days n] [stream...]
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	days := flags.Int("days", 0, "only include sessions started in the last days, all if 0")
+	_ = flags.Parse(args)
+
+	store, stats := setupStats()
+	if stats == nil {
+		return errors.New("statistics are disabled, configure stats.database")
+	}
+	defer store.Close()
+
+	var since time.Time
+	if *days > 0 {
+		since = time.Now().AddDate(0, 0, -*days)
+	}
+
+	ctx := context.Background()
+
+	streams := flags.Args()
+	if len(streams) == 0 {
+		var err error
+		streams, err = stats.Streams(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing streams: %w", err)
+		}
+		if len(streams) == 0 {
+			fmt.Println("no sessions recorded yet")
+		}
+	}
+
+	for i, stream := range streams {
+		report, err := stats.Report(ctx, stream, since)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(report)
+	}
+
+	return nil
+}